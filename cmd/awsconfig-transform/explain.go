@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	handlers "github.com/asecurityteam/awsconfig-transformerd/pkg/handlers/v1"
+)
+
+// currentConfiguration is reported for changes which were derived from the current
+// configuration of the resource rather than from a changed property, e.g. on creation
+const currentConfiguration = "configurationItem.configuration"
+
+// explanation lists the changed properties which contributed to one change of an output
+type explanation struct {
+	Change            int      `json:"change"`
+	ChangeType        string   `json:"changeType"`
+	ChangedProperties []string `json:"changedProperties"`
+}
+
+// explain attributes each change of the output to the ChangedProperties keys of the
+// notification which produced it. Each key is removed from the diff in turn and the
+// input is transformed again; a key contributed to a change if the change, or part
+// of it, disappears without the key. When several keys report the same values, e.g.
+// the public IP address of an EC2 instance in both Configuration.PublicIpAddress and
+// Configuration.NetworkInterfaces, none of them is needed for those values, so each key
+// is then kept alone instead, and contributed if it adds one of those values to what is
+// derived from the current configuration without any changed property.
+func explain(ctx context.Context, transformer *handlers.Transformer, input handlers.Input, output handlers.Output) ([]explanation, error) {
+	var message map[string]interface{}
+	if err := json.Unmarshal([]byte(input.Message), &message); err != nil {
+		return nil, err
+	}
+	diff, _ := message["configurationItemDiff"].(map[string]interface{})
+	properties, _ := diff["changedProperties"].(map[string]interface{})
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	explanations := make([]explanation, len(output.Changes))
+	// redundant holds the facets of each change which no key removes on its own
+	redundant := make([]map[string]bool, len(output.Changes))
+	for i, change := range output.Changes {
+		explanations[i] = explanation{Change: i, ChangeType: change.ChangeType, ChangedProperties: []string{}}
+		redundant[i] = facets(change)
+	}
+	for _, k := range keys {
+		removed := properties[k]
+		delete(properties, k)
+		ablated, err := json.Marshal(message)
+		properties[k] = removed
+		if err != nil {
+			return nil, err
+		}
+		without, err := transformer.Handle(ctx, handlers.Input{Message: string(ablated)})
+		for i, change := range output.Changes {
+			if err != nil {
+				explanations[i].ChangedProperties = append(explanations[i].ChangedProperties, k)
+				redundant[i] = map[string]bool{}
+				continue
+			}
+			lost := missing(change, without.Changes)
+			if len(lost) > 0 {
+				explanations[i].ChangedProperties = append(explanations[i].ChangedProperties, k)
+			}
+			for f := range lost {
+				delete(redundant[i], f)
+			}
+		}
+	}
+	var unexplained []int
+	for i := range explanations {
+		if len(redundant[i]) > 0 {
+			unexplained = append(unexplained, i)
+		}
+	}
+	if len(unexplained) > 0 && len(keys) > 0 {
+		baseline, err := transformWith(ctx, transformer, message, diff, map[string]interface{}{})
+		diff["changedProperties"] = properties
+		if err != nil {
+			baseline = handlers.Output{}
+		}
+		for _, k := range keys {
+			with, err := transformWith(ctx, transformer, message, diff, map[string]interface{}{k: properties[k]})
+			diff["changedProperties"] = properties
+			if err != nil {
+				continue
+			}
+			for _, i := range unexplained {
+				contributed := explanations[i].ChangedProperties
+				if !contains(contributed, k) && adds(redundant[i], output.Changes[i].ChangeType, with.Changes, baseline.Changes) {
+					explanations[i].ChangedProperties = append(contributed, k)
+				}
+			}
+		}
+		for _, i := range unexplained {
+			sort.Strings(explanations[i].ChangedProperties)
+		}
+	}
+	for i := range explanations {
+		if len(explanations[i].ChangedProperties) == 0 {
+			explanations[i].ChangedProperties = append(explanations[i].ChangedProperties, currentConfiguration)
+		}
+	}
+	return explanations, nil
+}
+
+// transformWith transforms the message with its changed properties replaced. The
+// caller restores the changed properties of the diff.
+func transformWith(ctx context.Context, transformer *handlers.Transformer, message, diff, properties map[string]interface{}) (handlers.Output, error) {
+	diff["changedProperties"] = properties
+	raw, err := json.Marshal(message)
+	if err != nil {
+		return handlers.Output{}, err
+	}
+	return transformer.Handle(ctx, handlers.Input{Message: string(raw)})
+}
+
+// present returns the facets of the changes of the given type
+func present(changeType string, changes []handlers.Change) map[string]bool {
+	result := map[string]bool{}
+	for _, c := range changes {
+		if c.ChangeType != changeType {
+			continue
+		}
+		for f := range facets(c) {
+			result[f] = true
+		}
+	}
+	return result
+}
+
+// missing returns the facets of the change which are not present in a change of the same type
+func missing(change handlers.Change, changes []handlers.Change) map[string]bool {
+	found := present(change.ChangeType, changes)
+	result := map[string]bool{}
+	for f := range facets(change) {
+		if !found[f] {
+			result[f] = true
+		}
+	}
+	return result
+}
+
+// adds reports whether one of the facets is present in a change of the given type, but
+// not in the baseline
+func adds(wanted map[string]bool, changeType string, changes, baseline []handlers.Change) bool {
+	with, without := present(changeType, changes), present(changeType, baseline)
+	for f := range wanted {
+		if with[f] && !without[f] {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// facets returns the individual values reported by a change
+func facets(change handlers.Change) map[string]bool {
+	result := map[string]bool{}
+	for _, ip := range change.PrivateIPAddresses {
+		result["private:"+ip] = true
+	}
+	for _, ip := range change.PublicIPAddresses {
+		result["public:"+ip] = true
+	}
+	for _, hostname := range change.Hostnames {
+		result["hostname:"+hostname] = true
+	}
+	for _, resource := range change.RelatedResources {
+		result["related:"+resource] = true
+	}
+	if change.CIDRBlock != "" {
+		result["cidr:"+change.CIDRBlock] = true
+	}
+	for _, listener := range change.Listeners {
+		raw, _ := json.Marshal(listener)
+		result["listener:"+string(raw)] = true
+	}
+	// the addresses of an interface are facets of their own, as an interface may be reported by
+	// several properties which each change some of its addresses
+	for _, ni := range change.NetworkInterfaces {
+		result["interface:"+ni.NetworkInterfaceID] = true
+		for _, ip := range ni.PrivateIPAddresses {
+			result["interface:"+ni.NetworkInterfaceID+":private:"+ip] = true
+		}
+		for _, ip := range ni.PublicIPAddresses {
+			result["interface:"+ni.NetworkInterfaceID+":public:"+ip] = true
+		}
+	}
+	for _, tc := range change.TagChanges {
+		raw, _ := json.Marshal(tc)
+		result["tag:"+string(raw)] = true
+	}
+	return result
+}
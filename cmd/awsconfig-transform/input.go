@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	handlers "github.com/asecurityteam/awsconfig-transformerd/pkg/handlers/v1"
+)
+
+var errUnknownDocument = errors.New("not an SQS message, SNS notification, configuration item change notification, configuration item or failure")
+
+// record is a single event read from an input, ready to be handed to the Transformer
+type record struct {
+	// Source identifies the record in error messages, e.g. "events.ndjson:12"
+	Source string
+	// Raw is the document as it was read, which is written back out for re-drive
+	Raw json.RawMessage
+	// Err is set when the document is valid JSON but not one of the supported shapes
+	Err          error
+	Input        handlers.Input
+	ResourceType string
+	ResourceID   string
+	ARN          string
+	StateID      int64
+}
+
+// envelope holds the fields used to tell the supported input shapes apart
+type envelope struct {
+	Body              *string          `json:"Body"`
+	Document          *json.RawMessage `json:"document"`
+	Message           *string          `json:"Message"`
+	ConfigurationItem *json.RawMessage `json:"configurationItem"`
+	ResourceType      string           `json:"resourceType"`
+}
+
+// notification holds the fields of a configuration item change notification needed to filter it
+type notification struct {
+	ConfigurationItem struct {
+		ResourceType         string `json:"resourceType"`
+		ResourceID           string `json:"resourceId"`
+		ARN                  string `json:"ARN"`
+		ConfigurationStateID int64  `json:"configurationStateId"`
+	} `json:"configurationItem"`
+}
+
+// decodeRecords decodes the JSON documents in the reader one at a time, and calls fn with the
+// record of each until fn returns false. A reader may contain a single document, or several
+// documents separated by whitespace such as newline-delimited JSON. Decoding stops at the
+// first document which is not valid JSON. Each document is one of:
+//
+//   - an SQS message whose Body is an SNS notification envelope, as archived from the queue
+//   - an SNS notification envelope whose Message is a configuration item change notification
+//   - a configuration item change notification which was not delivered through SNS
+//   - a bare configuration item, which is treated as the creation of the resource in its current state
+//   - a line of the failures file written by replay, whose original document is read
+func decodeRecords(r io.Reader, name string, fn func(record) bool) error {
+	decoder := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s:%d: %s", name, n, err)
+		}
+		if !fn(newRecord(raw, fmt.Sprintf("%s:%d", name, n))) {
+			return nil
+		}
+	}
+}
+
+// readRecords decodes every JSON document in the reader. See decodeRecords.
+func readRecords(r io.Reader, name string) ([]record, error) {
+	var records []record
+	err := decodeRecords(r, name, func(rec record) bool {
+		records = append(records, rec)
+		return true
+	})
+	return records, err
+}
+
+func newRecord(raw json.RawMessage, source string) record {
+	rec := record{Source: source, Raw: raw}
+	var e envelope
+	if err := json.Unmarshal(raw, &e); err != nil {
+		rec.Err = err
+		return rec
+	}
+	switch {
+	case e.Body != nil:
+		body := newRecord(json.RawMessage(*e.Body), source)
+		body.Raw = raw
+		return body
+	case e.Document != nil:
+		return newRecord(*e.Document, source)
+	case e.Message != nil:
+		if err := json.Unmarshal(raw, &rec.Input); err != nil {
+			rec.Err = err
+			return rec
+		}
+	case e.ConfigurationItem != nil:
+		rec.Input.Message = string(raw)
+	case e.ResourceType != "":
+		message, err := json.Marshal(map[string]interface{}{
+			"configurationItemDiff": map[string]interface{}{
+				"changedProperties": map[string]interface{}{},
+				"changeType":        "CREATE",
+			},
+			"configurationItem": raw,
+			"messageType":       "ConfigurationItemChangeNotification",
+		})
+		if err != nil {
+			rec.Err = err
+			return rec
+		}
+		rec.Input.Message = string(message)
+	default:
+		rec.Err = errUnknownDocument
+		return rec
+	}
+
+	// these fields are only needed for filtering and ordering, so a malformed message is left for the Transformer to report
+	var n notification
+	if err := json.Unmarshal([]byte(rec.Input.Message), &n); err == nil {
+		rec.ResourceType = n.ConfigurationItem.ResourceType
+		rec.ResourceID = n.ConfigurationItem.ResourceID
+		rec.ARN = n.ConfigurationItem.ARN
+		rec.StateID = n.ConfigurationItem.ConfigurationStateID
+	}
+	return rec
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRecords(t *testing.T) {
+	notification := `{"configurationItemDiff":{"changedProperties":{},"changeType":"CREATE"},"configurationItem":{"resourceType":"AWS::EC2::Subnet"}}`
+	sns := `{"Type":"Notification","Message":` + quote(notification) + `,"Timestamp":"2020-08-21T12:00:00.000Z"}`
+	item := `{"resourceType":"AWS::EC2::Instance","configuration":{}}`
+	failure := `{"source":"archive.ndjson:7","errorType":"ErrStateStore","error":"unavailable","retryable":true,"document":` + sns + `}`
+
+	records, err := readRecords(strings.NewReader(sns+"\n"+notification+"\n"+item+"\n"+failure+"\n"), "events.ndjson")
+	require.Nil(t, err)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, "events.ndjson:1", records[0].Source)
+	assert.Equal(t, notification, records[0].Input.Message)
+	assert.Equal(t, "2020-08-21T12:00:00.000Z", records[0].Input.Timestamp)
+	assert.Equal(t, "AWS::EC2::Subnet", records[0].ResourceType)
+
+	assert.Equal(t, "events.ndjson:2", records[1].Source)
+	assert.Equal(t, notification, records[1].Input.Message)
+	assert.Equal(t, "AWS::EC2::Subnet", records[1].ResourceType)
+
+	assert.Equal(t, "events.ndjson:3", records[2].Source)
+	assert.Equal(t, "AWS::EC2::Instance", records[2].ResourceType)
+	assert.Contains(t, records[2].Input.Message, `"changeType":"CREATE"`)
+	assert.Contains(t, records[2].Input.Message, `"configurationItem":`+item)
+
+	// the original document of a failure is replayed, and written again if it fails again
+	assert.Equal(t, "events.ndjson:4", records[3].Source)
+	assert.Equal(t, notification, records[3].Input.Message)
+	assert.Equal(t, sns, string(records[3].Raw))
+}
+
+func TestReadRecordsErrors(t *testing.T) {
+	records, err := readRecords(strings.NewReader(`{"Message":"{}"} {"unknown":true} {"Message":1}`), "events.json")
+	require.Nil(t, err)
+	require.Len(t, records, 3)
+	assert.Nil(t, records[0].Err)
+	assert.Equal(t, errUnknownDocument, records[1].Err)
+	assert.Equal(t, "events.json:2", records[1].Source)
+	assert.Equal(t, `{"unknown":true}`, string(records[1].Raw))
+	assert.NotNil(t, records[2].Err)
+
+	_, err = readRecords(strings.NewReader(`{"Message":`), "events.json")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "events.json:1")
+}
+
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,200 @@
+// Command awsconfig-transform transforms AWS Config change notifications read from
+// files or stdin without running the lambda handler behind a gateway.
+//
+//	awsconfig-transform [flags] [file ...]
+//	awsconfig-transform replay [flags] [archive ...]
+//
+// With no files, or a file named "-", notifications are read from stdin. See
+// decodeRecords for the supported input shapes, and replay for bulk backfills.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	handlers "github.com/asecurityteam/awsconfig-transformerd/pkg/handlers/v1"
+	"github.com/asecurityteam/logevent"
+	"github.com/asecurityteam/runhttp"
+)
+
+const (
+	formatPretty = "pretty"
+	formatNDJSON = "ndjson"
+)
+
+// explained is printed for each record in explain mode
+type explained struct {
+	Source      string          `json:"source"`
+	Output      handlers.Output `json:"output"`
+	Explanation []explanation   `json:"explanation"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns the exit code: 0 on success, 1 if any record
+// failed to transform and 2 for usage errors
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "replay" {
+		return replay(args[1:], stdin, stdout, stderr)
+	}
+	fs := flag.NewFlagSet("awsconfig-transform", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: awsconfig-transform [flags] [file ...]")
+		fmt.Fprintln(stderr, "       awsconfig-transform replay [flags] [archive ...]")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", formatPretty, "output format, pretty or ndjson")
+	types := fs.String("type", "", "comma separated resource types to transform, e.g. AWS::EC2::Instance. All types are transformed by default")
+	explainMode := fs.Bool("explain", false, "show which ChangedProperties keys contributed to each change")
+	validation := fs.String("validation", handlers.ValidationOff, "output schema validation mode, OFF, FLAG or REJECT")
+	verbose := fs.Bool("verbose", false, "write transformer logs to stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != formatPretty && *format != formatNDJSON {
+		fmt.Fprintf(stderr, "unknown format %s\n", *format)
+		return 2
+	}
+
+	ctx, transformer, err := newTransformer(*validation, *verbose, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	allowed := resourceTypes(*types)
+	var failed bool
+	// transform reports a record which fails, and only returns an error if its output cannot be written
+	transform := func(rec record) error {
+		// the resource type of a record which could not be parsed is unknown, so it is reported whatever the filter
+		if rec.Err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", rec.Source, rec.Err)
+			failed = true
+			return nil
+		}
+		if len(allowed) > 0 && !allowed[rec.ResourceType] {
+			return nil
+		}
+		output, err := transformer.Handle(ctx, rec.Input)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", rec.Source, err)
+			failed = true
+			return nil
+		}
+		var v interface{} = output
+		if *explainMode {
+			explanation, err := explain(ctx, transformer, rec.Input, output)
+			if err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", rec.Source, err)
+				failed = true
+				return nil
+			}
+			v = explained{Source: rec.Source, Output: output, Explanation: explanation}
+		}
+		return write(stdout, *format, v)
+	}
+	var writeErr error
+	if eachInput(fs.Args(), stdin, stderr, func(r io.Reader, name string) bool {
+		err := decodeRecords(r, name, func(rec record) bool {
+			writeErr = transform(rec)
+			return writeErr == nil
+		})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			failed = true
+		}
+		return writeErr == nil
+	}) {
+		failed = true
+	}
+	if writeErr != nil {
+		fmt.Fprintln(stderr, writeErr)
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// newTransformer returns a Transformer with the given validation mode, and a context
+// carrying a logger which discards logs unless verbose is set
+func newTransformer(validation string, verbose bool, stderr io.Writer) (context.Context, *handlers.Transformer, error) {
+	logOutput := ioutil.Discard
+	if verbose {
+		logOutput = stderr
+	}
+	ctx := logevent.NewContext(context.Background(), logevent.New(logevent.Config{Output: logOutput}))
+	component := &handlers.TransformerComponent{
+		LogFn:  runhttp.LoggerFromContext,
+		StatFn: runhttp.StatFromContext,
+	}
+	conf := component.Settings()
+	conf.Validation = validation
+	transformer, err := component.New(ctx, conf)
+	return ctx, transformer, err
+}
+
+// eachInput calls fn with each named file, or with stdin if there are none, until fn returns
+// false. Each file is closed once fn returns. Files which cannot be opened are reported and
+// skipped, and eachInput reports whether there were any.
+func eachInput(names []string, stdin io.Reader, stderr io.Writer, fn func(r io.Reader, name string) bool) bool {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	failed := false
+	for _, name := range names {
+		if name == "-" {
+			if !fn(stdin, name) {
+				break
+			}
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			failed = true
+			continue
+		}
+		more := fn(f, name)
+		f.Close()
+		if !more {
+			break
+		}
+	}
+	return failed
+}
+
+func resourceTypes(list string) map[string]bool {
+	result := map[string]bool{}
+	for _, t := range strings.Split(list, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			result[t] = true
+		}
+	}
+	return result
+}
+
+func write(w io.Writer, format string, v interface{}) error {
+	var b []byte
+	var err error
+	if format == formatNDJSON {
+		b, err = json.Marshal(v)
+	} else {
+		b, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
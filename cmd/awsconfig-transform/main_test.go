@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	handlers "github.com/asecurityteam/awsconfig-transformerd/pkg/handlers/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testdata(name string) string {
+	return filepath.Join("..", "..", "pkg", "handlers", "v1", "testdata", name)
+}
+
+func TestRunNDJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-format", "ndjson", testdata("ec2.1.json"), testdata("subnet.create.json")}, nil, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 2)
+	var output handlers.Output
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &output))
+	assert.Equal(t, "AWS::EC2::Instance", output.ResourceType)
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &output))
+	assert.Equal(t, "AWS::EC2::Subnet", output.ResourceType)
+}
+
+func TestRunTypeFilter(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-format", "ndjson", "-type", "AWS::EC2::Subnet", testdata("ec2.1.json"), testdata("subnet.create.json")}, nil, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"resourceType":"AWS::EC2::Subnet"`)
+}
+
+func TestRunTypeFilterReportsUnknownDocuments(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader(`{"unexpected":true}`)
+	code := run([]string{"-type", "AWS::EC2::Subnet"}, stdin, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "-:1: "+errUnknownDocument.Error())
+}
+
+func TestRunStdin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader(`{"resourceType":"AWS::EC2::Subnet","awsAccountId":"123456789012","awsRegion":"us-west-2",` +
+		`"configurationItemCaptureTime":"2020-08-21T12:00:00.000Z","configuration":{"cidrBlock":"10.0.0.0/24"}}`)
+	code := run(nil, stdin, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	var output handlers.Output
+	require.Nil(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Len(t, output.Changes, 1)
+	assert.Equal(t, "10.0.0.0/24", output.Changes[0].CIDRBlock)
+	assert.Equal(t, "ADDED", output.Changes[0].ChangeType)
+}
+
+func TestRunExplain(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-explain", testdata("ec2.1.json"), testdata("subnet.create.json")}, nil, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	decoder := json.NewDecoder(&stdout)
+	var update, create explained
+	require.Nil(t, decoder.Decode(&update))
+	require.Nil(t, decoder.Decode(&create))
+
+	require.Len(t, update.Explanation, 1)
+	// the released public IP address is reported by the interface and by the instance itself
+	assert.Equal(t, []string{"Configuration.NetworkInterfaces.0", "Configuration.PublicDnsName", "Configuration.PublicIpAddress"}, update.Explanation[0].ChangedProperties)
+	require.Len(t, create.Explanation, 1)
+	assert.Equal(t, []string{currentConfiguration}, create.Explanation[0].ChangedProperties)
+}
+
+func TestFacets(t *testing.T) {
+	change := handlers.Change{
+		ChangeType: "ADDED",
+		Listeners:  []handlers.Listener{{Protocol: "HTTPS", Port: 443, InstanceProtocol: "HTTP", InstancePort: 80}},
+		NetworkInterfaces: []handlers.NetworkInterface{{
+			NetworkInterfaceID: "eni-1",
+			PrivateIPAddresses: []string{"10.0.0.1"},
+			PublicIPAddresses:  []string{"203.0.113.1"},
+		}},
+	}
+	assert.Equal(t, map[string]bool{
+		`listener:{"protocol":"HTTPS","port":443,"instanceProtocol":"HTTP","instancePort":80}`: true,
+		"interface:eni-1":                    true,
+		"interface:eni-1:private:10.0.0.1":   true,
+		"interface:eni-1:public:203.0.113.1": true,
+	}, facets(change))
+
+	// the addresses of an interface may be reported by separate changes
+	split := []handlers.Change{
+		{ChangeType: "ADDED", Listeners: change.Listeners, NetworkInterfaces: []handlers.NetworkInterface{{NetworkInterfaceID: "eni-1", PrivateIPAddresses: []string{"10.0.0.1"}}}},
+		{ChangeType: "ADDED", NetworkInterfaces: []handlers.NetworkInterface{{NetworkInterfaceID: "eni-1", PublicIPAddresses: []string{"203.0.113.1"}}}},
+	}
+	assert.Empty(t, missing(change, split))
+	assert.Equal(t, map[string]bool{
+		`listener:{"protocol":"HTTPS","port":443,"instanceProtocol":"HTTP","instancePort":80}`: true,
+		"interface:eni-1:private:10.0.0.1": true,
+	}, missing(change, split[1:]))
+	assert.True(t, adds(facets(change), "ADDED", split[:1], split[1:]))
+	assert.False(t, adds(facets(change), "ADDED", split[1:], split[1:]))
+}
+
+func TestRunErrors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{testdata("ec2.malformed.json"), testdata("ec2.1.json"), testdata("missing.json")}, nil, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "ec2.malformed.json:1: malformed property")
+	assert.Contains(t, stderr.String(), "missing.json")
+	assert.Contains(t, stdout.String(), "AWS::EC2::Instance")
+
+	assert.Equal(t, 2, run([]string{"-format", "xml"}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"-validation", "sometimes"}, nil, &stdout, &stderr))
+}
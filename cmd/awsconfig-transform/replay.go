@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/token"
+	"hash/fnv"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	handlers "github.com/asecurityteam/awsconfig-transformerd/pkg/handlers/v1"
+)
+
+const (
+	// unknownResourceType is counted against records whose resource type could not be read
+	unknownResourceType = "unknown"
+	// unknownErrorType is the type of errors whose type is not exported
+	unknownErrorType = "unknown"
+)
+
+// replayResult is the outcome of transforming one archived record
+type replayResult struct {
+	Record record
+	Output handlers.Output
+	Err    error
+}
+
+// replayCounts are the outcomes for one resource type. Records which were transformed are
+// counted by the disposition of their output, and records which failed are either permanent
+// errors, if replaying them again cannot succeed, or retryable errors.
+type replayCounts struct {
+	Transformed     int
+	NoOp            int
+	Filtered        int
+	Unsupported     int
+	PermanentErrors int
+	RetryableErrors int
+}
+
+func (c *replayCounts) add(other replayCounts) {
+	c.Transformed += other.Transformed
+	c.NoOp += other.NoOp
+	c.Filtered += other.Filtered
+	c.Unsupported += other.Unsupported
+	c.PermanentErrors += other.PermanentErrors
+	c.RetryableErrors += other.RetryableErrors
+}
+
+// count records the outcome of a record which was transformed
+func (c *replayCounts) count(disposition string) {
+	switch disposition {
+	case handlers.DispositionTransformed:
+		c.Transformed++
+	case handlers.DispositionFiltered:
+		c.Filtered++
+	case handlers.DispositionUnsupported:
+		c.Unsupported++
+	default:
+		c.NoOp++
+	}
+}
+
+// replay streams archived notifications through the Transformer in parallel. Records are
+// decoded one at a time and the records of each resource are transformed by a single worker,
+// so the results for a resource are written in the order the changes happened. Records are
+// held for a window of the input to put the records of each resource in configurationStateId
+// order. Outputs are written to the results file and the original documents of records which
+// failed to transform are written to the failures file with the reason, from which they can
+// be replayed again.
+func replay(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("awsconfig-transform replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: awsconfig-transform replay [flags] [archive ...]")
+		fs.PrintDefaults()
+	}
+	workers := fs.Int("workers", runtime.NumCPU(), "number of records transformed in parallel")
+	window := fs.Int("window", 10000, "number of records held to order the records of each resource by configurationStateId")
+	resultsPath := fs.String("results", "results.ndjson", "file to which outputs are written as newline-delimited JSON")
+	failuresPath := fs.String("failures", "failures.ndjson", "file to which failed records are written with their original documents")
+	validation := fs.String("validation", handlers.ValidationOff, "output schema validation mode, OFF, FLAG or REJECT")
+	verbose := fs.Bool("verbose", false, "write transformer logs to stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *workers < 1 {
+		fmt.Fprintln(stderr, "workers must be at least 1")
+		return 2
+	}
+	if *window < 1 {
+		fmt.Fprintln(stderr, "window must be at least 1")
+		return 2
+	}
+	// the archives are read while the results are written, and both report errors
+	stderr = &lockedWriter{w: stderr}
+	ctx, transformer, err := newTransformer(*validation, *verbose, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	results, err := os.Create(*resultsPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer results.Close()
+	failures, err := os.Create(*failuresPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer failures.Close()
+
+	counts := map[string]*replayCounts{}
+	report := func(result replayResult) error {
+		resourceType := result.Record.ResourceType
+		if resourceType == "" {
+			resourceType = unknownResourceType
+		}
+		c, ok := counts[resourceType]
+		if !ok {
+			c = &replayCounts{}
+			counts[resourceType] = c
+		}
+
+		if result.Err == nil {
+			c.count(result.Output.Disposition)
+			return write(results, formatNDJSON, result.Output)
+		}
+		fmt.Fprintf(stderr, "%s: %s\n", result.Record.Source, result.Err)
+		f := newFailure(result)
+		if f.Retryable {
+			c.RetryableErrors++
+		} else {
+			c.PermanentErrors++
+		}
+		return write(failures, formatNDJSON, f)
+	}
+	// the archives are decoded while the records are transformed, so only the records held
+	// to be ordered are in memory. Decoding stops once a result cannot be written.
+	stop := make(chan struct{})
+	var failed bool
+	read := func(emit func(record) bool) {
+		if eachInput(fs.Args(), stdin, stderr, func(r io.Reader, name string) bool {
+			more := true
+			if err := decodeRecords(r, name, func(rec record) bool {
+				more = emit(rec)
+				return more
+			}); err != nil {
+				fmt.Fprintln(stderr, err)
+				failed = true
+			}
+			return more
+		}) {
+			failed = true
+		}
+	}
+	var writeErr error
+	for result := range transformAll(ctx, transformer, read, *workers, *window, stop) {
+		if writeErr != nil {
+			continue
+		}
+		if writeErr = report(result); writeErr != nil {
+			close(stop)
+		}
+	}
+	if writeErr != nil {
+		fmt.Fprintln(stderr, writeErr)
+		return 1
+	}
+
+	summary := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(summary, "RESOURCE TYPE\tTRANSFORMED\tNO_OP\tFILTERED\tUNSUPPORTED\tPERMANENT_ERRORS\tRETRYABLE_ERRORS")
+	resourceTypes := make([]string, 0, len(counts))
+	for resourceType := range counts {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	sort.Strings(resourceTypes)
+	var total replayCounts
+	for _, resourceType := range resourceTypes {
+		writeCounts(summary, resourceType, *counts[resourceType])
+		total.add(*counts[resourceType])
+	}
+	writeCounts(summary, "TOTAL", total)
+	_ = summary.Flush()
+
+	if failed || total.PermanentErrors > 0 || total.RetryableErrors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func writeCounts(w io.Writer, name string, c replayCounts) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", name, c.Transformed, c.NoOp, c.Filtered, c.Unsupported, c.PermanentErrors, c.RetryableErrors)
+}
+
+// failure is a line of the failures file. It holds the original document of a record which
+// failed to transform, which is replayed when the failures file is replayed.
+type failure struct {
+	Source    string          `json:"source"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Retryable bool            `json:"retryable"`
+	Document  json.RawMessage `json:"document"`
+}
+
+// newFailure describes a record which failed to transform
+func newFailure(result replayResult) failure {
+	return failure{
+		Source:    result.Record.Source,
+		ErrorType: errorType(result.Err),
+		Error:     result.Err.Error(),
+		Retryable: retryable(result.Err),
+		Document:  result.Record.Raw,
+	}
+}
+
+// errorType returns the name of the type of the error, e.g. ErrMissingValue, or unknown
+// for errors without a type of their own, such as those made by errors.New
+func errorType(err error) string {
+	typ := reflect.TypeOf(err)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if !token.IsExported(typ.Name()) {
+		return unknownErrorType
+	}
+	return typ.Name()
+}
+
+// retryable reports whether replaying a record which the transformer failed to transform may
+// succeed. Errors caused by the record itself, such as a malformed property or an output which
+// does not conform to the schema, recur every time it is replayed.
+func retryable(err error) bool {
+	var (
+		missing     domain.ErrMissingValue
+		message     domain.ErrMalformedMessage
+		property    domain.ErrMalformedProperty
+		previous    domain.ErrNilPreviousValue
+		messageType domain.ErrUnsupportedMessageType
+		violation   domain.ErrSchemaViolation
+	)
+	switch {
+	case errors.As(err, &missing), errors.As(err, &message), errors.As(err, &property),
+		errors.As(err, &previous), errors.As(err, &messageType), errors.As(err, &violation):
+		return false
+	}
+	return true
+}
+
+// reorderBuffer holds the records of each resource until they are released in
+// configurationStateId order. Once more than limit records are held, the records of the
+// resource which was first seen the longest ago are released, so records of a resource
+// which are further apart in the input than the window are not ordered with each other.
+// Records whose resource cannot be identified are released immediately. See resourceKey.
+type reorderBuffer struct {
+	limit   int
+	held    int
+	keys    []string
+	pending map[string][]record
+	release func(key string, group []record)
+}
+
+func newReorderBuffer(limit int, release func(key string, group []record)) *reorderBuffer {
+	return &reorderBuffer{limit: limit, pending: map[string][]record{}, release: release}
+}
+
+func (b *reorderBuffer) add(rec record) {
+	key := resourceKey(rec)
+	if key == "" {
+		b.release(key, []record{rec})
+		return
+	}
+	if _, ok := b.pending[key]; !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.pending[key] = append(b.pending[key], rec)
+	b.held++
+	for b.held > b.limit {
+		b.releaseOldest()
+	}
+}
+
+// flush releases every record which is held
+func (b *reorderBuffer) flush() {
+	for len(b.keys) > 0 {
+		b.releaseOldest()
+	}
+}
+
+func (b *reorderBuffer) releaseOldest() {
+	key := b.keys[0]
+	b.keys = b.keys[1:]
+	group := b.pending[key]
+	delete(b.pending, key)
+	b.held -= len(group)
+	sort.SliceStable(group, func(i, j int) bool {
+		return group[i].StateID < group[j].StateID
+	})
+	b.release(key, group)
+}
+
+// resourceKey identifies the resource of a record by its resource type and ID, which AWS Config
+// reports for every change, unlike the ARN which is blank on deletes. The ARN is only used for
+// records without a resource ID.
+func resourceKey(rec record) string {
+	if rec.ResourceType != "" && rec.ResourceID != "" {
+		return rec.ResourceType + "/" + rec.ResourceID
+	}
+	return rec.ARN
+}
+
+// transformAll transforms the records emitted by read with the given number of workers. The
+// records of a resource are always transformed by the same worker, so their results are sent
+// in the order the reorderBuffer releases them. read stops emitting once stop is closed.
+func transformAll(ctx context.Context, transformer *handlers.Transformer, read func(emit func(record) bool), workers, window int, stop <-chan struct{}) <-chan replayResult {
+	jobs := make([]chan []record, workers)
+	results := make(chan replayResult, workers)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		jobs[i] = make(chan []record, 1)
+		wg.Add(1)
+		go func(jobs <-chan []record) {
+			defer wg.Done()
+			for group := range jobs {
+				for _, rec := range group {
+					// a record which could not be parsed fails the same way every time it is replayed
+					if rec.Err != nil {
+						results <- replayResult{Record: rec, Err: domain.ErrMalformedMessage{Reason: rec.Err.Error()}}
+						continue
+					}
+					output, err := transformer.Handle(ctx, rec.Input)
+					results <- replayResult{Record: rec, Output: output, Err: err}
+				}
+			}
+		}(jobs[i])
+	}
+	var next uint32
+	buffer := newReorderBuffer(window, func(key string, group []record) {
+		// records without a resource are spread over the workers in turn
+		worker := next
+		next++
+		if key != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(key))
+			worker = h.Sum32()
+		}
+		jobs[worker%uint32(workers)] <- group
+	})
+	go func() {
+		stopped := false
+		read(func(rec record) bool {
+			select {
+			case <-stop:
+				stopped = true
+				return false
+			default:
+			}
+			buffer.add(rec)
+			return true
+		})
+		if !stopped {
+			buffer.flush()
+		}
+		for _, j := range jobs {
+			close(j)
+		}
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// lockedWriter serialises the writes of several goroutines
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	handlers "github.com/asecurityteam/awsconfig-transformerd/pkg/handlers/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// archive writes the testdata notifications as SQS messages, one per line
+func archive(t *testing.T, dir string, names ...string) string {
+	var lines []string
+	for _, name := range names {
+		data, err := ioutil.ReadFile(testdata(name))
+		require.Nil(t, err)
+		var compact bytes.Buffer
+		require.Nil(t, json.Compact(&compact, data))
+		line, err := json.Marshal(map[string]string{"MessageId": name, "Body": compact.String()})
+		require.Nil(t, err)
+		lines = append(lines, string(line))
+	}
+	path := filepath.Join(dir, "archive.ndjson")
+	require.Nil(t, ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	return path
+}
+
+// instanceChangeTimes returns the change times of the EC2 instance outputs in the results file
+func instanceChangeTimes(t *testing.T, results string) []string {
+	data, err := ioutil.ReadFile(results)
+	require.Nil(t, err)
+	var changeTimes []string
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var output handlers.Output
+		require.Nil(t, decoder.Decode(&output))
+		if output.ResourceType == "AWS::EC2::Instance" {
+			changeTimes = append(changeTimes, output.ChangeTime)
+		}
+	}
+	return changeTimes
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	// the instance lifecycle is archived out of order
+	path := archive(t, dir, "ec2.3.json", "subnet.create.json", "ec2.1.json", "ec2.4.json", "ec2.malformed.json", "ec2.0.json", "ec2.2.json")
+	results := filepath.Join(dir, "results.ndjson")
+	failures := filepath.Join(dir, "failures.ndjson")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"replay", "-workers", "4", "-results", results, "-failures", failures, path}, nil, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "archive.ndjson:5: malformed property")
+
+	assert.Equal(t, []string{
+		"2019-02-22T20:43:10.208Z",
+		"2019-02-22T20:48:32.538Z",
+		"2019-02-22T21:02:18.758Z",
+		"2019-02-22T21:17:53.073Z",
+		"2019-02-22T21:31:57.042Z",
+	}, instanceChangeTimes(t, results))
+
+	// the malformed record would fail again, so it is written as a permanent error
+	data, err := ioutil.ReadFile(failures)
+	require.Nil(t, err)
+	var f failure
+	require.Nil(t, json.Unmarshal(data, &f))
+	assert.Equal(t, path+":5", f.Source)
+	assert.Equal(t, "ErrMalformedProperty", f.ErrorType)
+	assert.False(t, f.Retryable)
+	assert.Contains(t, string(f.Document), `"MessageId":"ec2.malformed.json"`)
+
+	summary := stdout.String()
+	assert.Regexp(t, `AWS::EC2::Instance\s+5\s+0\s+0\s+0\s+1\s+0`, summary)
+	assert.Regexp(t, `AWS::EC2::Subnet\s+1\s+0\s+0\s+0\s+0\s+0`, summary)
+	assert.Regexp(t, `TOTAL\s+6\s+0\s+0\s+0\s+1\s+0`, summary)
+}
+
+func TestReplayDispositions(t *testing.T) {
+	dir := t.TempDir()
+	path := archive(t, dir, "eni.1.create.json", "ec2.0.json")
+	// the interface is no longer requester managed by an ELB, so it is filtered
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	data = bytes.Replace(data, []byte(`requesterManaged\\\":true`), []byte(`requesterManaged\\\":false`), 1)
+	require.Nil(t, ioutil.WriteFile(path, data, 0644))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"replay", "-results", filepath.Join(dir, "results.ndjson"),
+		"-failures", filepath.Join(dir, "failures.ndjson"), path}, nil, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Regexp(t, `TOTAL\s+1\s+0\s+1\s+0\s+0\s+0`, stdout.String())
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, retryable(domain.ErrStateStore{Operation: "get", Err: errors.New("timeout")}))
+	assert.True(t, retryable(errors.New("unexpected")))
+	assert.False(t, retryable(domain.ErrMalformedProperty{Field: "Configuration"}))
+	assert.False(t, retryable(handlers.ErrSchemaViolation{Reason: "required"}))
+	assert.False(t, retryable(domain.ErrMissingValue{Field: "ARN"}))
+}
+
+func TestNewFailure(t *testing.T) {
+	rec := record{Source: "archive.ndjson:3", Raw: json.RawMessage(`{"Message":"{}"}`)}
+	f := newFailure(replayResult{Record: rec, Err: domain.ErrStateStore{Operation: "update", Err: errors.New("timeout")}})
+	assert.Equal(t, failure{
+		Source:    "archive.ndjson:3",
+		ErrorType: "ErrStateStore",
+		Error:     "unable to update the state of : timeout",
+		Retryable: true,
+		Document:  rec.Raw,
+	}, f)
+	assert.Equal(t, "unknown", newFailure(replayResult{Record: rec, Err: errors.New("unexpected")}).ErrorType)
+}
+
+func TestReplayPermanentErrors(t *testing.T) {
+	dir := t.TempDir()
+	data, err := ioutil.ReadFile(testdata("ec2.0.json"))
+	require.Nil(t, err)
+	var input handlers.Input
+	require.Nil(t, json.Unmarshal(data, &input))
+	var message map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(input.Message), &message))
+	message["configurationItem"].(map[string]interface{})["configurationItemCaptureTime"] = "not-a-time"
+	line, err := json.Marshal(message)
+	require.Nil(t, err)
+	path := filepath.Join(dir, "archive.ndjson")
+	require.Nil(t, ioutil.WriteFile(path, line, 0644))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"replay", "-validation", "REJECT", "-results", filepath.Join(dir, "results.ndjson"),
+		"-failures", filepath.Join(dir, "failures.ndjson"), path}, nil, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Regexp(t, `AWS::EC2::Instance\s+0\s+0\s+0\s+0\s+1\s+0`, stdout.String())
+}
+
+func TestReorderBuffer(t *testing.T) {
+	var released [][]string
+	buffer := newReorderBuffer(10, func(_ string, group []record) {
+		var sources []string
+		for _, rec := range group {
+			sources = append(sources, rec.Source)
+		}
+		released = append(released, sources)
+	})
+	for _, rec := range []record{
+		{Source: "1", ResourceType: "AWS::EC2::Instance", ResourceID: "i-1", ARN: "a", StateID: 3},
+		{Source: "2", ARN: "b", StateID: 1},
+		{Source: "3"},
+		{Source: "4", ResourceType: "AWS::EC2::Instance", ResourceID: "i-1", ARN: "a", StateID: 1},
+		// AWS Config blanks the ARN of deletes
+		{Source: "5", ResourceType: "AWS::EC2::Instance", ResourceID: "i-1", StateID: 4},
+		{Source: "6"},
+		{Source: "7", ResourceType: "AWS::EC2::Subnet", ResourceID: "i-1", StateID: 2},
+	} {
+		buffer.add(rec)
+	}
+	// records without a resource are not held
+	assert.Equal(t, [][]string{{"3"}, {"6"}}, released)
+	buffer.flush()
+	assert.Equal(t, [][]string{{"3"}, {"6"}, {"4", "1", "5"}, {"2"}, {"7"}}, released)
+}
+
+func TestReorderBufferWindow(t *testing.T) {
+	var released []string
+	buffer := newReorderBuffer(1, func(_ string, group []record) {
+		for _, rec := range group {
+			released = append(released, rec.Source)
+		}
+	})
+	buffer.add(record{Source: "a2", ARN: "a", StateID: 2})
+	buffer.add(record{Source: "b1", ARN: "b", StateID: 1})
+	// the records of a are further apart than the window, so they are released in the order they were read
+	buffer.add(record{Source: "a1", ARN: "a", StateID: 1})
+	assert.Equal(t, []string{"a2", "b1"}, released)
+	buffer.flush()
+	assert.Equal(t, []string{"a2", "b1", "a1"}, released)
+}
+
+func TestReplayWindow(t *testing.T) {
+	dir := t.TempDir()
+	path := archive(t, dir, "ec2.1.json", "subnet.create.json", "ec2.0.json")
+	results := filepath.Join(dir, "results.ndjson")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"replay", "-window", "1", "-results", results,
+		"-failures", filepath.Join(dir, "failures.ndjson"), path}, nil, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Regexp(t, `TOTAL\s+3\s+0\s+0\s+0\s+0\s+0`, stdout.String())
+	// the records of the instance are further apart than the window, so they are not reordered
+	assert.Equal(t, []string{"2019-02-22T20:48:32.538Z", "2019-02-22T20:43:10.208Z"}, instanceChangeTimes(t, results))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
 	handlers "github.com/asecurityteam/awsconfig-transformerd/pkg/handlers/v1"
 	"github.com/asecurityteam/runhttp"
 	"github.com/asecurityteam/serverfull"
@@ -13,21 +14,71 @@ import (
 func main() {
 	ctx := context.Background()
 
-	transformer := &handlers.Transformer{
+	source, err := settings.NewEnvSource(os.Environ())
+	if err != nil {
+		panic(err.Error())
+	}
+
+	transformer, err := handlers.LoadTransformer(ctx, source, &handlers.TransformerComponent{
 		LogFn:  runhttp.LoggerFromContext,
 		StatFn: runhttp.StatFromContext,
+	})
+	if err != nil {
+		panic(err.Error())
 	}
 
 	handlersMap := map[string]serverfull.Function{
-		"awsConfigHandler": serverfull.NewFunction(transformer.Handle),
+		"awsConfigHandler": serverfull.NewFunctionWithErrors(
+			transformer.Handle,
+			domain.ErrMissingValue{},
+			domain.ErrMalformedMessage{},
+			domain.ErrMalformedProperty{},
+			domain.ErrNilPreviousValue{},
+			domain.ErrUnsupportedMessageType{},
+			domain.ErrSchemaViolation{},
+			domain.ErrStateStore{},
+		),
+		"assetHandler": serverfull.NewFunctionWithErrors(
+			(&handlers.AssetHandler{
+				LogFn:  runhttp.LoggerFromContext,
+				StatFn: runhttp.StatFromContext,
+				Assets: transformer.Assets,
+			}).Handle,
+			domain.ErrInvalidQuery{},
+			domain.ErrStateStore{},
+		),
+		"attributionHandler": serverfull.NewFunctionWithErrors(
+			(&handlers.AttributionHandler{
+				LogFn:        runhttp.LoggerFromContext,
+				StatFn:       runhttp.StatFromContext,
+				Attributions: transformer.Attributions,
+			}).Handle,
+			domain.ErrInvalidQuery{},
+			domain.ErrStateStore{},
+		),
+		"schemaHandler": serverfull.NewFunction(handlers.SchemaHandler),
 	}
 
-	source, err := settings.NewEnvSource(os.Environ())
+	fetcher := &serverfull.StaticFetcher{Functions: handlersMap}
+	// the router is served as serverfull.Start would, but continues the W3C trace context of
+	// each request so that the spans of the transformer join the trace of the gateway
+	router := serverfull.NewRouter(&serverfull.RouterConfig{Fetcher: fetcher})
+	rt := new(runhttp.Runtime)
+	err = settings.NewComponent(
+		ctx,
+		&settings.PrefixSource{Source: source, Prefix: []string{"serverfull"}},
+		runhttp.NewComponent().WithHandler(handlers.TraceContext(router)),
+		rt,
+	)
 	if err != nil {
 		panic(err.Error())
 	}
-	fetcher := &serverfull.StaticFetcher{Functions: handlersMap}
-	if err := serverfull.Start(ctx, source, fetcher); err != nil {
+	err = rt.Run()
+	// the spans still held by the tracer provider are flushed, and its file and the stores closed
+	if shutdownErr := transformer.Shutdown(ctx); err == nil {
+		err = shutdownErr
+	}
+	if err != nil {
 		panic(err.Error())
 	}
 }
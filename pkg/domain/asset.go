@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Asset is the current snapshot of a resource, built from the transformed outputs
+// emitted for it
+type Asset struct {
+	ARN          string            `json:"arn"`
+	ResourceType string            `json:"resourceType"`
+	ResourceID   string            `json:"resourceId"`
+	ResourceName string            `json:"resourceName,omitempty"`
+	AccountID    string            `json:"accountId"`
+	Region       string            `json:"region"`
+	Tags         map[string]string `json:"tags,omitempty"`
+
+	PrivateIPAddresses []string `json:"privateIpAddresses,omitempty"`
+	PublicIPAddresses  []string `json:"publicIpAddresses,omitempty"`
+	Hostnames          []string `json:"hostnames,omitempty"`
+	CIDRBlocks         []string `json:"cidrBlocks,omitempty"`
+
+	// FirstSeen and LastSeen are the earliest and latest change times of the outputs
+	// emitted for the resource
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// AssetQuery selects assets from an AssetStore. Exactly one field is set.
+type AssetQuery struct {
+	// IP matches assets which hold the IP address
+	IP net.IP
+	// Hostname matches assets which hold the hostname, ignoring case
+	Hostname string
+	// CIDR matches assets which hold an IP address within the block, or a CIDR block
+	// which overlaps it
+	CIDR *net.IPNet
+	// ARN matches the asset with the ARN
+	ARN string
+}
+
+// AssetStore holds the current snapshot of every resource which has not been deleted,
+// keyed by ARN. Implementations must be safe for concurrent use.
+type AssetStore interface {
+	// Get returns the asset, and false if no asset has been stored for the ARN
+	Get(ctx context.Context, arn string) (Asset, bool, error)
+	// Put replaces the asset
+	Put(ctx context.Context, asset Asset) error
+	// Update replaces the asset with the one returned by the function, which is given the
+	// current asset and whether one has been stored. No other update of the asset is made
+	// between the read and the write.
+	Update(ctx context.Context, arn string, fn func(Asset, bool) (Asset, error)) error
+	// Delete removes the asset, if it exists
+	Delete(ctx context.Context, arn string) error
+	// Find returns the assets matching the query, ordered by ARN
+	Find(ctx context.Context, query AssetQuery) ([]Asset, error)
+}
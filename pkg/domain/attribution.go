@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Attribution is an interval during which a resource held a public IP address or hostname
+type Attribution struct {
+	// Address is the public IP address or hostname
+	Address      string            `json:"address"`
+	ARN          string            `json:"arn"`
+	ResourceType string            `json:"resourceType"`
+	AccountID    string            `json:"accountId"`
+	Region       string            `json:"region"`
+	Tags         map[string]string `json:"tags,omitempty"`
+
+	// Start is the change time at which the address was added to the resource. It is zero,
+	// and the start is unknown, when the address was deleted from the resource before it
+	// was seen being added.
+	Start time.Time `json:"start"`
+	// End is the change time at which the address was deleted from the resource. It is
+	// zero while the resource still holds the address.
+	End time.Time `json:"end"`
+}
+
+// Covers reports whether the resource held the address at the given time. The start of
+// the interval is inclusive and the end is exclusive. An interval whose start is unknown
+// covers no time, as it is not known how long before its end the address was held.
+func (a Attribution) Covers(t time.Time) bool {
+	return !a.Start.IsZero() && !t.Before(a.Start) && (a.End.IsZero() || t.Before(a.End))
+}
+
+// AttributionStore holds the attribution intervals of every address. Implementations
+// must be safe for concurrent use.
+type AttributionStore interface {
+	// Get returns the intervals of the address
+	Get(ctx context.Context, address string) ([]Attribution, error)
+	// Update replaces the intervals of the address with those returned by the function,
+	// which is given the current intervals. No other update of the address is made
+	// between the read and the write.
+	Update(ctx context.Context, address string, fn func([]Attribution) ([]Attribution, error)) error
+}
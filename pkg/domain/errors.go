@@ -0,0 +1,107 @@
+package domain
+
+import "fmt"
+
+// ErrMissingValue is returned when a configuration item is missing a required field
+type ErrMissingValue struct {
+	Field        string
+	ResourceType string
+}
+
+func (e ErrMissingValue) Error() string {
+	if e.ResourceType == "" {
+		return fmt.Sprintf("no field %s was provided", e.Field)
+	}
+	return fmt.Sprintf("no field %s was provided for %s", e.Field, e.ResourceType)
+}
+
+// ErrMalformedMessage is returned when the AWS Config notification within the
+// SNS envelope cannot be parsed
+type ErrMalformedMessage struct {
+	Reason string
+}
+
+func (e ErrMalformedMessage) Error() string {
+	return fmt.Sprintf("malformed AWS Config message: %s", e.Reason)
+}
+
+// ErrMalformedProperty is returned when a configuration or a changed property in
+// the configuration diff does not have the expected shape. Field is the path to the
+// offending property, e.g. "ChangedProperties.Configuration.NetworkInterfaces.0".
+type ErrMalformedProperty struct {
+	Field        string
+	ResourceType string
+	Err          error
+}
+
+func (e ErrMalformedProperty) Error() string {
+	return fmt.Sprintf("malformed property %s for %s: %s", e.Field, e.ResourceType, e.Err)
+}
+
+// Unwrap returns the underlying decoding error
+func (e ErrMalformedProperty) Unwrap() error {
+	return e.Err
+}
+
+// ErrNilPreviousValue is returned when a changed property which must describe the
+// previous state of a resource, e.g. the configuration of a deleted resource, has
+// no previous value
+type ErrNilPreviousValue struct {
+	Field        string
+	ResourceType string
+}
+
+func (e ErrNilPreviousValue) Error() string {
+	return fmt.Sprintf("no previous value for %s was provided for %s", e.Field, e.ResourceType)
+}
+
+// ErrUnsupportedMessageType is returned when the AWS Config notification is not a
+// configuration item change notification
+type ErrUnsupportedMessageType struct {
+	MessageType string
+}
+
+func (e ErrUnsupportedMessageType) Error() string {
+	return fmt.Sprintf("unsupported AWS Config message type %s", e.MessageType)
+}
+
+// ErrSchemaViolation is returned when a transformed output does not conform to the published JSON Schema
+type ErrSchemaViolation struct {
+	Path   string
+	Reason string
+}
+
+func (e ErrSchemaViolation) Error() string {
+	return fmt.Sprintf("output does not conform to schema at %s: %s", e.Path, e.Reason)
+}
+
+// ErrStateStore is returned when the state of a resource cannot be read from, or written
+// to, the state store. Address is set instead of ARN when the attributions of an address
+// were being read or written.
+type ErrStateStore struct {
+	Operation string
+	ARN       string
+	Address   string
+	Err       error
+}
+
+func (e ErrStateStore) Error() string {
+	if e.Address != "" {
+		return fmt.Sprintf("unable to %s the attributions of %s: %s", e.Operation, e.Address, e.Err)
+	}
+	return fmt.Sprintf("unable to %s the state of %s: %s", e.Operation, e.ARN, e.Err)
+}
+
+// Unwrap returns the underlying state store error
+func (e ErrStateStore) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidQuery is returned when a query does not select anything, or is not well formed
+type ErrInvalidQuery struct {
+	Reason string
+}
+
+func (e ErrInvalidQuery) Error() string {
+	return fmt.Sprintf("invalid query: %s", e.Reason)
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrMissingValue(t *testing.T) {
+	require.Equal(t, "no field AWSAccountID was provided", ErrMissingValue{Field: "AWSAccountID"}.Error())
+	require.Equal(t,
+		"no field ChangedProperties.Configuration was provided for AWS::EC2::Instance",
+		ErrMissingValue{Field: "ChangedProperties.Configuration", ResourceType: "AWS::EC2::Instance"}.Error(),
+	)
+}
+
+func TestErrMalformedMessage(t *testing.T) {
+	e := ErrMalformedMessage{Reason: "invalid character 'o' in literal null (expecting 'u')"}
+	require.Equal(t, "malformed AWS Config message: invalid character 'o' in literal null (expecting 'u')", e.Error())
+}
+
+func TestErrMalformedProperty(t *testing.T) {
+	inner := &json.SyntaxError{Offset: 1}
+	e := ErrMalformedProperty{Field: "ChangedProperties.Configuration", ResourceType: "AWS::EC2::Subnet", Err: inner}
+	require.Equal(t, "malformed property ChangedProperties.Configuration for AWS::EC2::Subnet: "+inner.Error(), e.Error())
+
+	var syntaxErr *json.SyntaxError
+	require.True(t, errors.As(e, &syntaxErr))
+}
+
+func TestErrNilPreviousValue(t *testing.T) {
+	e := ErrNilPreviousValue{Field: "ChangedProperties.Configuration", ResourceType: "AWS::EC2::NetworkInterface"}
+	require.Equal(t, "no previous value for ChangedProperties.Configuration was provided for AWS::EC2::NetworkInterface", e.Error())
+}
+
+func TestErrUnsupportedMessageType(t *testing.T) {
+	e := ErrUnsupportedMessageType{MessageType: "ConfigurationSnapshotDeliveryCompleted"}
+	require.Equal(t, "unsupported AWS Config message type ConfigurationSnapshotDeliveryCompleted", e.Error())
+}
+
+func TestErrSchemaViolation(t *testing.T) {
+	e := ErrSchemaViolation{Path: "changes[0].changeType", Reason: "invalid"}
+	require.Equal(t, "output does not conform to schema at changes[0].changeType: invalid", e.Error())
+}
+
+func TestErrStateStore(t *testing.T) {
+	inner := errors.New("database not open")
+	e := ErrStateStore{Operation: "get", ARN: "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-1", Err: inner}
+	require.Equal(t, "unable to get the state of arn:aws:ec2:us-west-2:123456789012:subnet/subnet-1: database not open", e.Error())
+	require.True(t, errors.Is(e, inner))
+
+	e = ErrStateStore{Operation: "query", Address: "34.222.120.66", Err: inner}
+	require.Equal(t, "unable to query the attributions of 34.222.120.66: database not open", e.Error())
+}
+
+func TestErrInvalidQuery(t *testing.T) {
+	e := ErrInvalidQuery{Reason: "exactly one of ip, hostname, cidr or arn must be set"}
+	require.Equal(t, "invalid query: exactly one of ip, hostname, cidr or arn must be set", e.Error())
+}
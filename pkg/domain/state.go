@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ResourceState is the last network identity emitted for a resource
+type ResourceState struct {
+	ARN          string `json:"arn"`
+	ResourceType string `json:"resourceType"`
+
+	// ConfigurationStateID is the configurationStateId of the configuration item which produced the state
+	ConfigurationStateID int64 `json:"configurationStateId"`
+	// CaptureTime is the configurationItemCaptureTime of the configuration item which produced the state
+	CaptureTime time.Time `json:"captureTime"`
+
+	PrivateIPAddresses []string   `json:"privateIpAddresses,omitempty"`
+	PublicIPAddresses  []string   `json:"publicIpAddresses,omitempty"`
+	Hostnames          []string   `json:"hostnames,omitempty"`
+	CIDRBlocks         []string   `json:"cidrBlocks,omitempty"`
+	RelatedResources   []string   `json:"relatedResources,omitempty"`
+	Listeners          []Listener `json:"listeners,omitempty"`
+
+	// NetworkInterfaces break the IP addresses of an EC2 instance down by network interface
+	NetworkInterfaces []NetworkInterface `json:"networkInterfaces,omitempty"`
+
+	// Deleted is set once the resource has been deleted. The state is kept so that
+	// events for the resource which are delivered late can be recognised as stale.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// NetworkInterface details the IP addresses which belong to one network interface
+type NetworkInterface struct {
+	// NetworkInterfaceID is the ID of the ENI (required)
+	NetworkInterfaceID string `json:"networkInterfaceId"`
+
+	// SubnetID is the ID of the subnet of the ENI
+	SubnetID string `json:"subnetId,omitempty"`
+
+	// VpcID is the ID of the VPC of the ENI
+	VpcID string `json:"vpcId,omitempty"`
+
+	// PrivateDNSName is the private DNS name of the primary private IP address of the ENI
+	PrivateDNSName string `json:"privateDnsName,omitempty"`
+
+	// PrivateIPAddresses are the private IP addresses of the ENI
+	PrivateIPAddresses []string `json:"privateIpAddresses,omitempty"`
+
+	// PublicIPAddresses are the public IP addresses of the ENI
+	PublicIPAddresses []string `json:"publicIpAddresses,omitempty"`
+}
+
+// Listener is a port exposed by a load balancer
+type Listener struct {
+	// Protocol is the protocol of the load balancer port, e.g. "HTTPS" (required)
+	Protocol string `json:"protocol"`
+
+	// Port is the port exposed by the load balancer (required)
+	Port int `json:"port"`
+
+	// InstanceProtocol is the protocol used to forward traffic to the registered instances
+	InstanceProtocol string `json:"instanceProtocol,omitempty"`
+
+	// InstancePort is the port to which traffic is forwarded on the registered instances
+	InstancePort int `json:"instancePort,omitempty"`
+}
+
+// StateStore holds the last known state of resources, keyed by ARN. Implementations
+// must be safe for concurrent use.
+type StateStore interface {
+	// Get returns the state of the resource, and false if no state has been stored for it
+	Get(ctx context.Context, arn string) (ResourceState, bool, error)
+	// Put replaces the state of the resource
+	Put(ctx context.Context, state ResourceState) error
+	// Update replaces the state of the resource with the one returned by the function,
+	// which is given the current state and whether one has been stored. No other update
+	// of the resource is made between the read and the write.
+	Update(ctx context.Context, arn string, fn func(ResourceState, bool) (ResourceState, error)) error
+}
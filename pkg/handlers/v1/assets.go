@@ -0,0 +1,188 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/logs"
+)
+
+var errAssetsDisabled = errors.New("the asset store is not enabled")
+
+// recordAsset applies the output to the snapshot of the resource in the asset store. The
+// addresses, hostnames and CIDR blocks of ADDED changes are added to the snapshot and those
+// of DELETED changes are removed, and the resource is removed once it has been deleted.
+func (t *Transformer) recordAsset(ctx context.Context, event awsConfigEvent, output Output) error {
+	if output.ARN == "" {
+		return nil
+	}
+	if event.ConfigurationItemDiff.ChangeType == delete {
+		if err := t.Assets.Delete(ctx, output.ARN); err != nil {
+			return domain.ErrStateStore{Operation: "delete", ARN: output.ARN, Err: err}
+		}
+		return nil
+	}
+	changeTime, _ := time.Parse(time.RFC3339Nano, output.ChangeTime)
+	var current, gone domain.ResourceState
+	for _, change := range output.Changes {
+		identity := &current
+		if change.ChangeType == deleted {
+			identity = &gone
+		}
+		identity.PrivateIPAddresses = append(identity.PrivateIPAddresses, change.PrivateIPAddresses...)
+		identity.PublicIPAddresses = append(identity.PublicIPAddresses, change.PublicIPAddresses...)
+		identity.Hostnames = append(identity.Hostnames, change.Hostnames...)
+		if change.CIDRBlock != "" {
+			identity.CIDRBlocks = append(identity.CIDRBlocks, change.CIDRBlock)
+		}
+	}
+	// the snapshot is read and replaced in a single update, so that the changes of
+	// concurrent events for the resource are not lost
+	err := t.Assets.Update(ctx, output.ARN, func(asset domain.Asset, found bool) (domain.Asset, error) {
+		if !found || changeTime.Before(asset.FirstSeen) {
+			asset.FirstSeen = changeTime
+		}
+		if changeTime.After(asset.LastSeen) {
+			asset.LastSeen = changeTime
+		}
+		asset.ARN = output.ARN
+		asset.ResourceType = output.ResourceType
+		asset.ResourceID = output.ResourceID
+		asset.ResourceName = output.ResourceName
+		asset.AccountID = output.AccountID
+		asset.Region = output.Region
+		asset.Tags = output.Tags
+		asset.PrivateIPAddresses = applyChange(asset.PrivateIPAddresses, current.PrivateIPAddresses, gone.PrivateIPAddresses)
+		asset.PublicIPAddresses = applyChange(asset.PublicIPAddresses, current.PublicIPAddresses, gone.PublicIPAddresses)
+		asset.Hostnames = applyChange(asset.Hostnames, current.Hostnames, gone.Hostnames)
+		asset.CIDRBlocks = applyChange(asset.CIDRBlocks, current.CIDRBlocks, gone.CIDRBlocks)
+		return asset, nil
+	})
+	if err != nil {
+		return domain.ErrStateStore{Operation: "update", ARN: output.ARN, Err: err}
+	}
+	return nil
+}
+
+// applyChange removes the deleted values from the list and adds the added values. A value
+// which is both added and deleted by the same output is kept.
+func applyChange(values, addedValues, deletedValues []string) []string {
+	return uniqueSorted(append(sliceDiff(values, deletedValues), addedValues...))
+}
+
+// AssetQuery is the input of the asset snapshot handler. Exactly one field must be set.
+type AssetQuery struct {
+	// IP selects the resources which currently hold the public or private IP address
+	IP string `json:"ip,omitempty"`
+	// Hostname selects the resources which currently hold the hostname
+	Hostname string `json:"hostname,omitempty"`
+	// CIDR selects the resources which hold an IP address within the CIDR block, or a
+	// CIDR block which overlaps it
+	CIDR string `json:"cidr,omitempty"`
+	// ARN selects the resource with the Amazon Resource Name
+	ARN string `json:"arn,omitempty"`
+}
+
+// AssetSnapshot is the output of the asset snapshot handler
+type AssetSnapshot struct {
+	// Assets are the resources matching the query, ordered by ARN (required)
+	Assets []AssetView `json:"assets"`
+}
+
+// AssetView is the current snapshot of a resource
+type AssetView struct {
+	domain.Asset
+
+	// SinceFirstSeen is the time elapsed since the first change seen for the resource, e.g. "26h3m4s"
+	SinceFirstSeen string `json:"sinceFirstSeen"`
+
+	// SinceLastSeen is the time elapsed since the last change seen for the resource
+	SinceLastSeen string `json:"sinceLastSeen"`
+}
+
+// AssetHandler is a lambda handler which looks up the current snapshot of resources
+type AssetHandler struct {
+	LogFn  domain.LogFn
+	StatFn domain.StatFn
+
+	// Assets is the store fed by the Transformer. Every query fails when it is nil.
+	Assets domain.AssetStore
+
+	// Now returns the current time. The zero value uses time.Now.
+	Now func() time.Time
+}
+
+// Handle returns the resources matching the query
+func (h *AssetHandler) Handle(ctx context.Context, input AssetQuery) (AssetSnapshot, error) {
+	query, err := parseAssetQuery(input)
+	if err != nil {
+		h.LogFn(ctx).Info(logs.AssetQueryError{Reason: err.Error()})
+		return AssetSnapshot{}, err
+	}
+	if h.Assets == nil {
+		err := domain.ErrStateStore{Operation: "query", ARN: input.ARN, Err: errAssetsDisabled}
+		h.LogFn(ctx).Error(logs.AssetQueryError{Reason: err.Error()})
+		return AssetSnapshot{}, err
+	}
+	assets, err := h.Assets.Find(ctx, query)
+	if err != nil {
+		err = domain.ErrStateStore{Operation: "query", ARN: input.ARN, Err: err}
+		h.LogFn(ctx).Error(logs.AssetQueryError{Reason: err.Error()})
+		return AssetSnapshot{}, err
+	}
+	h.StatFn(ctx).Count("event.awsconfig.transformer.asset.query", 1)
+
+	now := time.Now()
+	if h.Now != nil {
+		now = h.Now()
+	}
+	snapshot := AssetSnapshot{Assets: make([]AssetView, 0, len(assets))}
+	for _, asset := range assets {
+		snapshot.Assets = append(snapshot.Assets, AssetView{
+			Asset:          asset,
+			SinceFirstSeen: now.Sub(asset.FirstSeen).Round(time.Second).String(),
+			SinceLastSeen:  now.Sub(asset.LastSeen).Round(time.Second).String(),
+		})
+	}
+	return snapshot, nil
+}
+
+// parseAssetQuery checks that exactly one field of the query is set, and parses it
+func parseAssetQuery(input AssetQuery) (domain.AssetQuery, error) {
+	var query domain.AssetQuery
+	ip := strings.TrimSpace(input.IP)
+	hostname := strings.TrimSuffix(strings.TrimSpace(input.Hostname), ".")
+	cidr := strings.TrimSpace(input.CIDR)
+	arn := strings.TrimSpace(input.ARN)
+	set := 0
+	for _, v := range []string{ip, hostname, cidr, arn} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return query, domain.ErrInvalidQuery{Reason: "exactly one of ip, hostname, cidr or arn must be set"}
+	}
+	switch {
+	case ip != "":
+		query.IP = net.ParseIP(ip)
+		if query.IP == nil {
+			return query, domain.ErrInvalidQuery{Reason: "ip " + ip + " is not an IP address"}
+		}
+	case hostname != "":
+		query.Hostname = hostname
+	case cidr != "":
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return query, domain.ErrInvalidQuery{Reason: "cidr " + cidr + " is not a CIDR block"}
+		}
+		query.CIDR = block
+	default:
+		query.ARN = arn
+	}
+	return query, nil
+}
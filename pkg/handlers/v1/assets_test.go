@@ -0,0 +1,105 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/store"
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const subnetARN = "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-000aa0a000a00a0aa"
+
+func TestTransformWithAssets(t *testing.T) {
+	assets := store.NewMemoryAssets()
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, Assets: assets}
+	handler := &AssetHandler{
+		LogFn:  logFn,
+		StatFn: runhttp.StatFromContext,
+		Assets: assets,
+		Now:    func() time.Time { return time.Date(2019, 2, 23, 21, 2, 18, 758000000, time.UTC) },
+	}
+	ctx := context.Background()
+	for _, name := range []string{"ec2.0.json", "ec2.1.json", "ec2.2.json", "subnet.create.json"} {
+		_, err := transformer.Handle(ctx, readInput(t, name))
+		require.Nil(t, err, name)
+	}
+
+	instance := domain.Asset{
+		ARN:                lifecycleARN,
+		ResourceType:       "AWS::EC2::Instance",
+		ResourceID:         "i-0a763ac3ee37d8d2b",
+		AccountID:          "123456789012",
+		Region:             "us-west-2",
+		Tags:               map[string]string{"service_name": "foo-bar", "business_unit": "CISO-Security"},
+		PrivateIPAddresses: []string{"172.31.30.79"},
+		PublicIPAddresses:  []string{"34.219.72.29"},
+		Hostnames:          []string{"ec2-34-219-72-29.us-west-2.compute.amazonaws.com"},
+		FirstSeen:          time.Date(2019, 2, 22, 20, 43, 10, 208000000, time.UTC),
+		LastSeen:           time.Date(2019, 2, 22, 21, 2, 18, 758000000, time.UTC),
+	}
+	snapshot, err := handler.Handle(ctx, AssetQuery{IP: "34.219.72.29"})
+	require.Nil(t, err)
+	require.Len(t, snapshot.Assets, 1)
+	assert.Equal(t, AssetView{Asset: instance, SinceFirstSeen: "24h19m9s", SinceLastSeen: "24h0m0s"}, snapshot.Assets[0])
+
+	// the address released when the instance was stopped is no longer attributed to it
+	snapshot, err = handler.Handle(ctx, AssetQuery{IP: "34.222.120.66"})
+	require.Nil(t, err)
+	assert.Empty(t, snapshot.Assets)
+
+	snapshot, err = handler.Handle(ctx, AssetQuery{Hostname: "ec2-34-219-72-29.us-west-2.compute.amazonaws.com."})
+	require.Nil(t, err)
+	require.Len(t, snapshot.Assets, 1)
+	assert.Equal(t, lifecycleARN, snapshot.Assets[0].ARN)
+
+	snapshot, err = handler.Handle(ctx, AssetQuery{CIDR: "10.0.0.128/25"})
+	require.Nil(t, err)
+	require.Len(t, snapshot.Assets, 1)
+	assert.Equal(t, subnetARN, snapshot.Assets[0].ARN)
+	assert.Equal(t, []string{"10.0.0.0/24"}, snapshot.Assets[0].CIDRBlocks)
+
+	// deleted resources are removed from the store
+	_, err = transformer.Handle(ctx, readInput(t, "subnet.delete.json"))
+	require.Nil(t, err)
+	snapshot, err = handler.Handle(ctx, AssetQuery{ARN: subnetARN})
+	require.Nil(t, err)
+	assert.Empty(t, snapshot.Assets)
+}
+
+func TestAssetHandlerInvalidQuery(t *testing.T) {
+	handler := &AssetHandler{LogFn: logFn, StatFn: runhttp.StatFromContext, Assets: store.NewMemoryAssets()}
+	tc := []struct {
+		Name  string
+		Query AssetQuery
+	}{
+		{Name: "empty", Query: AssetQuery{IP: " "}},
+		{Name: "several", Query: AssetQuery{IP: "34.219.72.29", ARN: lifecycleARN}},
+		{Name: "ip", Query: AssetQuery{IP: "34.219.72"}},
+		{Name: "cidr", Query: AssetQuery{CIDR: "10.0.0.0"}},
+	}
+	for _, tt := range tc {
+		_, err := handler.Handle(context.Background(), tt.Query)
+		var invalid domain.ErrInvalidQuery
+		assert.True(t, errors.As(err, &invalid), tt.Name)
+	}
+}
+
+func TestAssetHandlerDisabled(t *testing.T) {
+	handler := &AssetHandler{LogFn: logFn, StatFn: runhttp.StatFromContext}
+	_, err := handler.Handle(context.Background(), AssetQuery{ARN: lifecycleARN})
+	var storeErr domain.ErrStateStore
+	require.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, errAssetsDisabled, storeErr.Err)
+}
+
+func TestApplyChange(t *testing.T) {
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, applyChange([]string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.3"}, []string{"10.0.0.1"}))
+	assert.Equal(t, []string{"10.0.0.1"}, applyChange([]string{"10.0.0.1"}, []string{"10.0.0.1"}, []string{"10.0.0.1"}))
+	assert.Nil(t, applyChange([]string{"10.0.0.1"}, nil, []string{"10.0.0.1"}))
+}
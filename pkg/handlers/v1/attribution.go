@@ -0,0 +1,239 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/logs"
+)
+
+var errAttributionsDisabled = errors.New("the attribution store is not enabled")
+
+// recordAttributions opens an attribution interval for every public IP address and
+// hostname added by the output, and closes the open interval of every one deleted by it.
+// Private IP addresses are not recorded, as the same address is reused across VPCs.
+func (t *Transformer) recordAttributions(ctx context.Context, output Output) error {
+	changeTime, err := time.Parse(time.RFC3339Nano, output.ChangeTime)
+	if output.ARN == "" || err != nil {
+		return nil
+	}
+	attribution := domain.Attribution{
+		ARN:          output.ARN,
+		ResourceType: output.ResourceType,
+		AccountID:    output.AccountID,
+		Region:       output.Region,
+		Tags:         output.Tags,
+	}
+	for _, change := range output.Changes {
+		addresses := make([]string, 0, len(change.PublicIPAddresses)+len(change.Hostnames))
+		for _, ip := range change.PublicIPAddresses {
+			addresses = append(addresses, normaliseIP(ip))
+		}
+		for _, hostname := range change.Hostnames {
+			addresses = append(addresses, normaliseHostname(hostname))
+		}
+		for _, address := range uniqueSorted(addresses) {
+			attribution.Address = address
+			update := func(intervals []domain.Attribution) ([]domain.Attribution, error) {
+				if change.ChangeType == deleted {
+					return releaseAddress(intervals, attribution, changeTime), nil
+				}
+				return claimAddress(intervals, attribution, changeTime), nil
+			}
+			if err := t.Attributions.Update(ctx, address, update); err != nil {
+				return domain.ErrStateStore{Operation: "update", Address: address, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// claimAddress opens an interval for the resource at the given time, unless the resource
+// already holds the address then. An interval which was closed before it was seen being
+// opened starts at the given time instead.
+func claimAddress(intervals []domain.Attribution, attribution domain.Attribution, at time.Time) []domain.Attribution {
+	for i, interval := range intervals {
+		if interval.ARN != attribution.ARN {
+			continue
+		}
+		if interval.Covers(at) {
+			return intervals
+		}
+		if interval.Start.IsZero() && at.Before(interval.End) {
+			intervals[i].Start = at
+			return sortAttributions(intervals)
+		}
+	}
+	attribution.Start = at
+	return sortAttributions(append(intervals, attribution))
+}
+
+// releaseAddress closes the open interval of the resource at the given time. If the
+// resource was not seen claiming the address, an interval whose start is unknown is recorded.
+func releaseAddress(intervals []domain.Attribution, attribution domain.Attribution, at time.Time) []domain.Attribution {
+	for i, interval := range intervals {
+		if interval.ARN == attribution.ARN && interval.End.IsZero() && !at.Before(interval.Start) {
+			intervals[i].End = at
+			return intervals
+		}
+	}
+	attribution.End = at
+	return sortAttributions(append(intervals, attribution))
+}
+
+func sortAttributions(intervals []domain.Attribution) []domain.Attribution {
+	sort.SliceStable(intervals, func(i, j int) bool {
+		if !intervals[i].Start.Equal(intervals[j].Start) {
+			return intervals[i].Start.Before(intervals[j].Start)
+		}
+		return intervals[i].ARN < intervals[j].ARN
+	})
+	return intervals
+}
+
+func normaliseIP(address string) string {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	return address
+}
+
+func normaliseHostname(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+}
+
+// AttributionQuery is the input of the attribution handler. Exactly one of IP and
+// Hostname must be set.
+type AttributionQuery struct {
+	// IP is the public IP address to resolve
+	IP string `json:"ip,omitempty"`
+	// Hostname is the public DNS name to resolve
+	Hostname string `json:"hostname,omitempty"`
+	// Time is the moment at which the address is resolved, date-time format. The
+	// current time is used when it is not set.
+	Time string `json:"time,omitempty"`
+}
+
+// AttributionResult is the output of the attribution handler
+type AttributionResult struct {
+	// Address is the resolved IP address or hostname (required)
+	Address string `json:"address"`
+
+	// Time is the moment at which the address was resolved (required)
+	Time string `json:"time"`
+
+	// Attributions are the intervals during which a resource held the address which
+	// cover the time, ordered by start (required)
+	Attributions []AttributionInterval `json:"attributions"`
+
+	// Overlap is set when more than one resource claimed the address at the time
+	Overlap bool `json:"overlap"`
+}
+
+// AttributionInterval is an interval during which a resource held an address
+type AttributionInterval struct {
+	ARN          string            `json:"arn"`
+	ResourceType string            `json:"resourceType"`
+	AccountID    string            `json:"accountId"`
+	Region       string            `json:"region"`
+	Tags         map[string]string `json:"tags,omitempty"`
+
+	// Start is when the address was added to the resource
+	Start string `json:"start,omitempty"`
+
+	// End is when the address was deleted from the resource, or empty if it still holds it
+	End string `json:"end,omitempty"`
+}
+
+// AttributionHandler is a lambda handler which resolves the resources holding a public IP
+// address or hostname at a point in time
+type AttributionHandler struct {
+	LogFn  domain.LogFn
+	StatFn domain.StatFn
+
+	// Attributions is the store fed by the Transformer. Every query fails when it is nil.
+	Attributions domain.AttributionStore
+
+	// Now returns the current time. The zero value uses time.Now.
+	Now func() time.Time
+}
+
+// Handle returns the intervals of the address which cover the time of the query
+func (h *AttributionHandler) Handle(ctx context.Context, input AttributionQuery) (AttributionResult, error) {
+	address, at, err := h.parseQuery(input)
+	if err != nil {
+		h.LogFn(ctx).Info(logs.AttributionQueryError{Reason: err.Error()})
+		return AttributionResult{}, err
+	}
+	if h.Attributions == nil {
+		err := domain.ErrStateStore{Operation: "query", Address: address, Err: errAttributionsDisabled}
+		h.LogFn(ctx).Error(logs.AttributionQueryError{Reason: err.Error()})
+		return AttributionResult{}, err
+	}
+	intervals, err := h.Attributions.Get(ctx, address)
+	if err != nil {
+		err = domain.ErrStateStore{Operation: "query", Address: address, Err: err}
+		h.LogFn(ctx).Error(logs.AttributionQueryError{Reason: err.Error()})
+		return AttributionResult{}, err
+	}
+	h.StatFn(ctx).Count("event.awsconfig.transformer.attribution.query", 1)
+
+	result := AttributionResult{
+		Address:      address,
+		Time:         at.Format(time.RFC3339Nano),
+		Attributions: []AttributionInterval{},
+	}
+	claimants := map[string]bool{}
+	for _, interval := range intervals {
+		if !interval.Covers(at) {
+			continue
+		}
+		claimants[interval.ARN] = true
+		result.Attributions = append(result.Attributions, AttributionInterval{
+			ARN:          interval.ARN,
+			ResourceType: interval.ResourceType,
+			AccountID:    interval.AccountID,
+			Region:       interval.Region,
+			Tags:         interval.Tags,
+			Start:        formatCaptureTime(interval.Start),
+			End:          formatCaptureTime(interval.End),
+		})
+	}
+	result.Overlap = len(claimants) > 1
+	if result.Overlap {
+		h.StatFn(ctx).Count("event.awsconfig.transformer.attribution.overlap", 1)
+	}
+	return result, nil
+}
+
+// parseQuery returns the normalised address and the time of the query
+func (h *AttributionHandler) parseQuery(input AttributionQuery) (string, time.Time, error) {
+	ip := strings.TrimSpace(input.IP)
+	hostname := normaliseHostname(input.Hostname)
+	if (ip == "") == (hostname == "") {
+		return "", time.Time{}, domain.ErrInvalidQuery{Reason: "exactly one of ip or hostname must be set"}
+	}
+	address := hostname
+	if ip != "" {
+		if net.ParseIP(ip) == nil {
+			return "", time.Time{}, domain.ErrInvalidQuery{Reason: "ip " + ip + " is not an IP address"}
+		}
+		address = normaliseIP(ip)
+	}
+	if strings.TrimSpace(input.Time) == "" {
+		if h.Now != nil {
+			return address, h.Now().UTC(), nil
+		}
+		return address, time.Now().UTC(), nil
+	}
+	at, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(input.Time))
+	if err != nil {
+		return "", time.Time{}, domain.ErrInvalidQuery{Reason: "time " + input.Time + " is not a date-time"}
+	}
+	return address, at, nil
+}
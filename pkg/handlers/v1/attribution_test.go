@@ -0,0 +1,142 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/store"
+	"github.com/asecurityteam/logevent"
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformWithAttributions(t *testing.T) {
+	attributions := store.NewMemoryAttributions()
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, Attributions: attributions}
+	handler := &AttributionHandler{LogFn: logFn, StatFn: runhttp.StatFromContext, Attributions: attributions}
+	ctx := context.Background()
+	for _, name := range []string{"ec2.0.json", "ec2.1.json", "ec2.2.json"} {
+		_, err := transformer.Handle(ctx, readInput(t, name))
+		require.Nil(t, err, name)
+	}
+
+	held := AttributionInterval{
+		ARN:          lifecycleARN,
+		ResourceType: "AWS::EC2::Instance",
+		AccountID:    "123456789012",
+		Region:       "us-west-2",
+		Tags:         map[string]string{"service_name": "foo-bar", "business_unit": "CISO-Security"},
+		Start:        "2019-02-22T20:43:10.208Z",
+		End:          "2019-02-22T20:48:32.538Z",
+	}
+	result, err := handler.Handle(ctx, AttributionQuery{IP: "34.222.120.66", Time: "2019-02-22T20:45:00Z"})
+	require.Nil(t, err)
+	assert.Equal(t, AttributionResult{
+		Address:      "34.222.120.66",
+		Time:         "2019-02-22T20:45:00Z",
+		Attributions: []AttributionInterval{held},
+	}, result)
+
+	result, err = handler.Handle(ctx, AttributionQuery{Hostname: "EC2-34-222-120-66.us-west-2.compute.amazonaws.com", Time: "2019-02-22T20:45:00Z"})
+	require.Nil(t, err)
+	assert.Equal(t, []AttributionInterval{held}, result.Attributions)
+
+	// the address was released when the instance was stopped
+	result, err = handler.Handle(ctx, AttributionQuery{IP: "34.222.120.66", Time: "2019-02-22T20:48:32.538Z"})
+	require.Nil(t, err)
+	assert.Empty(t, result.Attributions)
+
+	// the address assigned when the instance was started again is still held
+	result, err = handler.Handle(ctx, AttributionQuery{IP: "34.219.72.29"})
+	require.Nil(t, err)
+	require.Len(t, result.Attributions, 1)
+	assert.Equal(t, "2019-02-22T21:02:18.758Z", result.Attributions[0].Start)
+	assert.Empty(t, result.Attributions[0].End)
+	assert.False(t, result.Overlap)
+}
+
+func TestAttributionOverlap(t *testing.T) {
+	attributions := store.NewMemoryAttributions()
+	handler := &AttributionHandler{LogFn: logFn, StatFn: runhttp.StatFromContext, Attributions: attributions}
+	ctx := context.Background()
+	start := time.Date(2019, 2, 22, 20, 0, 0, 0, time.UTC)
+	for i, arn := range []string{"arn:aws:ec2:us-west-2:123456789012:instance/i-1", "arn:aws:ec2:us-west-2:123456789012:instance/i-2"} {
+		claim := domain.Attribution{Address: "34.222.120.66", ARN: arn}
+		require.Nil(t, attributions.Update(ctx, claim.Address, func(intervals []domain.Attribution) ([]domain.Attribution, error) {
+			return claimAddress(intervals, claim, start.Add(time.Duration(i)*time.Hour)), nil
+		}))
+	}
+
+	result, err := handler.Handle(ctx, AttributionQuery{IP: "34.222.120.66", Time: "2019-02-22T20:30:00Z"})
+	require.Nil(t, err)
+	assert.Len(t, result.Attributions, 1)
+	assert.False(t, result.Overlap)
+
+	result, err = handler.Handle(ctx, AttributionQuery{IP: "34.222.120.66", Time: "2019-02-22T21:30:00Z"})
+	require.Nil(t, err)
+	assert.Len(t, result.Attributions, 2)
+	assert.True(t, result.Overlap)
+}
+
+func TestClaimAndReleaseAddress(t *testing.T) {
+	arn := "arn:aws:ec2:us-west-2:123456789012:instance/i-1"
+	attribution := domain.Attribution{Address: "34.222.120.66", ARN: arn}
+	t0 := time.Date(2019, 2, 22, 20, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	t2 := t1.Add(time.Hour)
+
+	intervals := claimAddress(nil, attribution, t0)
+	// a repeated claim while the address is held is ignored
+	intervals = claimAddress(intervals, attribution, t1)
+	intervals = releaseAddress(intervals, attribution, t2)
+	assert.Equal(t, []domain.Attribution{{Address: "34.222.120.66", ARN: arn, Start: t0, End: t2}}, intervals)
+
+	// a release which is seen before the claim records an interval whose start is unknown,
+	// which covers no time until the claim completes it
+	intervals = releaseAddress(nil, attribution, t1)
+	assert.Equal(t, []domain.Attribution{{Address: "34.222.120.66", ARN: arn, End: t1}}, intervals)
+	assert.False(t, intervals[0].Covers(t0))
+	intervals = claimAddress(intervals, attribution, t0)
+	assert.Equal(t, []domain.Attribution{{Address: "34.222.120.66", ARN: arn, Start: t0, End: t1}}, intervals)
+	assert.True(t, intervals[0].Covers(t0))
+	assert.False(t, intervals[0].Covers(t1))
+}
+
+func TestAttributionHandlerInvalidQuery(t *testing.T) {
+	handler := &AttributionHandler{LogFn: logFn, StatFn: runhttp.StatFromContext, Attributions: store.NewMemoryAttributions()}
+	tc := []struct {
+		Name  string
+		Query AttributionQuery
+	}{
+		{Name: "empty", Query: AttributionQuery{Time: "2019-02-22T20:30:00Z"}},
+		{Name: "both", Query: AttributionQuery{IP: "34.222.120.66", Hostname: "ec2-34-222-120-66.us-west-2.compute.amazonaws.com"}},
+		{Name: "ip", Query: AttributionQuery{IP: "34.222.120"}},
+		{Name: "time", Query: AttributionQuery{IP: "34.222.120.66", Time: "yesterday"}},
+	}
+	for _, tt := range tc {
+		_, err := handler.Handle(context.Background(), tt.Query)
+		var invalid domain.ErrInvalidQuery
+		assert.True(t, errors.As(err, &invalid), tt.Name)
+	}
+
+	var buf bytes.Buffer
+	handler = &AttributionHandler{
+		LogFn:  func(context.Context) domain.Logger { return logevent.New(logevent.Config{Output: &buf}) },
+		StatFn: runhttp.StatFromContext,
+	}
+	_, err := handler.Handle(context.Background(), AttributionQuery{IP: "34.222.120.66"})
+	var storeErr domain.ErrStateStore
+	require.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, errAttributionsDisabled, storeErr.Err)
+	assert.Equal(t, "34.222.120.66", storeErr.Address)
+	assert.Empty(t, storeErr.ARN)
+	events := decodeLogs(t, &buf)
+	require.Len(t, events, 1)
+	assert.Equal(t, "attribution-query-error", events[0]["message"])
+	assert.Equal(t, storeErr.Error(), events[0]["reason"])
+}
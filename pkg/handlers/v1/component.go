@@ -0,0 +1,209 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/asecurityteam/settings"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/store"
+)
+
+const (
+	// StateStoreNone disables the state, asset or attribution store
+	StateStoreNone = "NONE"
+	// StateStoreMemory keeps resource states, assets or attributions in memory
+	StateStoreMemory = "MEMORY"
+	// StateStoreBolt persists resource states, assets or attributions in an embedded database file
+	StateStoreBolt = "BOLT"
+)
+
+// TransformerConfig is the configuration container for a Transformer.
+type TransformerConfig struct {
+	Validation             string        `description:"Output schema validation mode. One of OFF, FLAG or REJECT."`
+	StateStore             string        `description:"Store of the last known state of each resource, used to compute changes and drop stale events. One of NONE, MEMORY or BOLT."`
+	StatePath              string        `description:"Path of the database file used by the BOLT state store."`
+	StateTombstoneTTL      time.Duration `description:"How long the MEMORY state store keeps the state of a deleted resource to recognise late events as stale. Zero keeps it forever."`
+	StaleEvents            string        `description:"Handling of events older than the last event processed for the resource. One of DROP or MARK."`
+	AssetStore             string        `description:"Store of the current snapshot of each resource, used by the asset query API. One of NONE, MEMORY or BOLT."`
+	AssetPath              string        `description:"Path of the database file used by the BOLT asset store."`
+	AttributionStore       string        `description:"Store of the intervals during which each public IP address and hostname was held by a resource. One of NONE, MEMORY or BOLT."`
+	AttributionPath        string        `description:"Path of the database file used by the BOLT attribution store."`
+	CorporateRanges        []string      `description:"CIDR blocks of publicly routable ranges which are only reachable from the corporate network."`
+	TagAliases             []string      `description:"Tag key aliases as alias=canonical pairs, e.g. ServiceName=service_name. Keys are matched ignoring case and punctuation."`
+	OwnerTags              []string      `description:"Canonical tag keys read into the owner of every output as field=key pairs. Fields are service, businessUnit, team and contact."`
+	TagChangeTypes         []string      `description:"Resource types without network information for which tag changes are emitted, e.g. AWS::S3::Bucket, or * for all of them. None by default."`
+	TagChangeExcludedTypes []string      `description:"Resource types for which tag changes are never emitted, even if they match TagChangeTypes."`
+	Filter                 *FilterConfig
+	Tracing                *TracingConfig
+}
+
+// Name of the configuration root.
+func (*TransformerConfig) Name() string {
+	return "transformer"
+}
+
+// Description returns the help information for the configuration root.
+func (*TransformerConfig) Description() string {
+	return "AWS Config event transformer settings."
+}
+
+// TransformerComponent implements the settings.Component interface for a Transformer.
+type TransformerComponent struct {
+	LogFn  domain.LogFn
+	StatFn domain.StatFn
+}
+
+// Settings returns a configuration with all defaults set.
+func (*TransformerComponent) Settings() *TransformerConfig {
+	return &TransformerConfig{
+		Validation:        ValidationOff,
+		StateStore:        StateStoreNone,
+		StatePath:         "state.db",
+		StateTombstoneTTL: store.DefaultTombstoneTTL,
+		StaleEvents:       StaleDrop,
+		AssetStore:        StateStoreNone,
+		AssetPath:         "assets.db",
+		AttributionStore:  StateStoreNone,
+		AttributionPath:   "attribution.db",
+		Filter:            &FilterConfig{},
+		Tracing: &TracingConfig{
+			Exporter:    TracingNone,
+			Path:        "traces.json",
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "awsconfig-transformerd",
+		},
+	}
+}
+
+// New produces a Transformer bound to the given configuration.
+func (c *TransformerComponent) New(ctx context.Context, conf *TransformerConfig) (_ *Transformer, err error) {
+	// the exporter and stores opened before a failure are released, so that their files are closed
+	var opened []func(context.Context) error
+	defer func() {
+		if err != nil {
+			_ = release(ctx, opened)
+		}
+	}()
+	validation := strings.ToUpper(conf.Validation)
+	switch validation {
+	case ValidationOff, ValidationFlag, ValidationReject:
+	default:
+		return nil, fmt.Errorf("unknown validation mode %s", conf.Validation)
+	}
+	staleEvents := strings.ToUpper(conf.StaleEvents)
+	switch staleEvents {
+	case "":
+		staleEvents = StaleDrop
+	case StaleDrop, StaleMark:
+	default:
+		return nil, fmt.Errorf("unknown stale event mode %s", conf.StaleEvents)
+	}
+	corporateRanges, err := parseRanges(conf.CorporateRanges)
+	if err != nil {
+		return nil, fmt.Errorf("invalid corporate ranges: %s", err.Error())
+	}
+	transformer := &Transformer{
+		LogFn:           c.LogFn,
+		StatFn:          c.StatFn,
+		Validation:      validation,
+		StaleEvents:     staleEvents,
+		CorporateRanges: corporateRanges,
+
+		TagChangeTypes:         conf.TagChangeTypes,
+		TagChangeExcludedTypes: conf.TagChangeExcludedTypes,
+	}
+	if conf.Filter != nil {
+		filter := EventFilter(*conf.Filter)
+		if err := filter.validate(); err != nil {
+			return nil, fmt.Errorf("invalid filter: %s", err.Error())
+		}
+		if !filter.empty() {
+			transformer.Filter = &filter
+		}
+	}
+	if conf.Tracing != nil {
+		provider, shutdown, err := NewTracerProvider(ctx, conf.Tracing)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, shutdown)
+		if provider != nil {
+			transformer.Tracer = provider.Tracer(tracerName)
+		}
+	}
+	if len(conf.TagAliases) > 0 || len(conf.OwnerTags) > 0 {
+		tags, err := NewTagNormaliser(conf.TagAliases, conf.OwnerTags)
+		if err != nil {
+			return nil, err
+		}
+		transformer.Tags = tags
+	}
+	switch strings.ToUpper(conf.StateStore) {
+	case "", StateStoreNone:
+	case StateStoreMemory:
+		state := store.NewMemory()
+		state.TombstoneTTL = conf.StateTombstoneTTL
+		transformer.State = state
+	case StateStoreBolt:
+		state, err := store.OpenBolt(conf.StatePath)
+		if err != nil {
+			return nil, err
+		}
+		transformer.State = state
+		opened = append(opened, closer(state))
+	default:
+		return nil, fmt.Errorf("unknown state store %s", conf.StateStore)
+	}
+	switch strings.ToUpper(conf.AssetStore) {
+	case "", StateStoreNone:
+	case StateStoreMemory:
+		transformer.Assets = store.NewMemoryAssets()
+	case StateStoreBolt:
+		assets, err := store.OpenBoltAssets(conf.AssetPath)
+		if err != nil {
+			return nil, err
+		}
+		transformer.Assets = assets
+		opened = append(opened, closer(assets))
+	default:
+		return nil, fmt.Errorf("unknown asset store %s", conf.AssetStore)
+	}
+	switch strings.ToUpper(conf.AttributionStore) {
+	case "", StateStoreNone:
+	case StateStoreMemory:
+		transformer.Attributions = store.NewMemoryAttributions()
+	case StateStoreBolt:
+		attributions, err := store.OpenBoltAttributions(conf.AttributionPath)
+		if err != nil {
+			return nil, err
+		}
+		transformer.Attributions = attributions
+		opened = append(opened, closer(attributions))
+	default:
+		return nil, fmt.Errorf("unknown attribution store %s", conf.AttributionStore)
+	}
+	transformer.opened = opened
+	return transformer, nil
+}
+
+// closer adapts a store to the release functions of the transformer
+func closer(c io.Closer) func(context.Context) error {
+	return func(context.Context) error {
+		return c.Close()
+	}
+}
+
+// LoadTransformer is a convenience method for binding the source to the component.
+func LoadTransformer(ctx context.Context, source settings.Source, c *TransformerComponent) (*Transformer, error) {
+	dst := new(Transformer)
+	err := settings.NewComponent(ctx, source, c, dst)
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
@@ -0,0 +1,266 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/store"
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformerComponent(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	assert.Equal(t, ValidationOff, conf.Validation)
+
+	conf.Validation = "reject"
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Equal(t, ValidationReject, transformer.Validation)
+	assert.NotNil(t, transformer.LogFn)
+	assert.NotNil(t, transformer.StatFn)
+
+	conf.Validation = "sometimes"
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestTransformerComponentStateStore(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	assert.Equal(t, StateStoreNone, conf.StateStore)
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Nil(t, transformer.State)
+
+	conf.StateStore = "memory"
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.IsType(t, &store.Memory{}, transformer.State)
+	assert.Equal(t, store.DefaultTombstoneTTL, transformer.State.(*store.Memory).TombstoneTTL)
+
+	conf.StateTombstoneTTL = time.Hour
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Equal(t, time.Hour, transformer.State.(*store.Memory).TombstoneTTL)
+
+	conf.StateStore = StateStoreBolt
+	conf.StatePath = filepath.Join(t.TempDir(), "state.db")
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.IsType(t, &store.Bolt{}, transformer.State)
+	require.Nil(t, transformer.State.(*store.Bolt).Close())
+
+	conf.StatePath = filepath.Join(t.TempDir(), "missing", "state.db")
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+
+	conf.StateStore = "redis"
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+
+	// the state store is closed when a later store cannot be opened, so the file can be opened again
+	conf.StateStore = StateStoreBolt
+	conf.StatePath = filepath.Join(t.TempDir(), "state.db")
+	conf.AssetStore = "redis"
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+	state, err := store.OpenBolt(conf.StatePath)
+	require.Nil(t, err)
+	require.Nil(t, state.Close())
+}
+
+func TestTransformerComponentStaleEvents(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	assert.Equal(t, StaleDrop, conf.StaleEvents)
+
+	conf.StaleEvents = "mark"
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Equal(t, StaleMark, transformer.StaleEvents)
+
+	conf.StaleEvents = ""
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Equal(t, StaleDrop, transformer.StaleEvents)
+
+	conf.StaleEvents = "ignore"
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestTransformerComponentAssetStore(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	assert.Equal(t, StateStoreNone, conf.AssetStore)
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Nil(t, transformer.Assets)
+
+	conf.AssetStore = "memory"
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.IsType(t, &store.MemoryAssets{}, transformer.Assets)
+
+	conf.AssetStore = StateStoreBolt
+	conf.AssetPath = filepath.Join(t.TempDir(), "assets.db")
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.IsType(t, &store.BoltAssets{}, transformer.Assets)
+	require.Nil(t, transformer.Assets.(*store.BoltAssets).Close())
+
+	conf.AssetStore = "redis"
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestTransformerComponentAttributionStore(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	assert.Equal(t, StateStoreNone, conf.AttributionStore)
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Nil(t, transformer.Attributions)
+
+	conf.AttributionStore = "memory"
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.IsType(t, &store.MemoryAttributions{}, transformer.Attributions)
+
+	conf.AttributionStore = StateStoreBolt
+	conf.AttributionPath = filepath.Join(t.TempDir(), "attribution.db")
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.IsType(t, &store.BoltAttributions{}, transformer.Attributions)
+	require.Nil(t, transformer.Attributions.(*store.BoltAttributions).Close())
+
+	conf.AttributionStore = "redis"
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestTransformerComponentCorporateRanges(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Empty(t, transformer.CorporateRanges)
+
+	conf.CorporateRanges = []string{"203.0.113.0/24", "2001:db8::/32"}
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.Len(t, transformer.CorporateRanges, 2)
+	assert.Equal(t, "203.0.113.0/24", transformer.CorporateRanges[0].String())
+	assert.Equal(t, "2001:db8::/32", transformer.CorporateRanges[1].String())
+
+	conf.CorporateRanges = []string{"203.0.113.0"}
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestTransformerComponentTags(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Nil(t, transformer.Tags)
+
+	conf.TagAliases = []string{"ServiceName=service_name"}
+	conf.OwnerTags = []string{"service=ServiceName"}
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.NotNil(t, transformer.Tags)
+	assert.Equal(t, map[string]string{"service": "service_name"}, transformer.Tags.OwnerKeys)
+
+	conf.OwnerTags = []string{"manager=manager"}
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+
+	conf.OwnerTags = nil
+	conf.TagAliases = []string{"service_name"}
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestTransformerComponentTagChangeTypes(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	assert.Empty(t, conf.TagChangeTypes)
+	// the resource types without network information are unsupported unless they are enabled
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.False(t, transformer.emitsTagChanges("AWS::Lambda::Function"))
+
+	conf.TagChangeTypes = []string{AllResourceTypes}
+	conf.TagChangeExcludedTypes = []string{"AWS::S3::Bucket"}
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.True(t, transformer.emitsTagChanges("AWS::Lambda::Function"))
+	assert.False(t, transformer.emitsTagChanges("AWS::S3::Bucket"))
+
+	// AWS Config blanks the ARN of a deleted bucket, which cannot be synthesised, so the
+	// delete is unsupported when tag changes are enabled rather than failing
+	cmp = &TransformerComponent{LogFn: logFn, StatFn: runhttp.StatFromContext}
+	conf = cmp.Settings()
+	conf.TagChangeTypes = []string{AllResourceTypes}
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	raw, err := json.Marshal(awsConfigEvent{
+		ConfigurationItemDiff: configurationItemDiff{ChangeType: delete},
+		ConfigurationItem: configurationItem{
+			ConfigurationItemCaptureTime: "2019-03-27T19:12:28.624Z",
+			AWSAccountID:                 "123456789012",
+			ResourceType:                 "AWS::S3::Bucket",
+			ResourceID:                   "config-test-bucket",
+			AWSRegion:                    "us-west-2",
+		},
+		MessageType: configurationItemChangeNotification,
+	})
+	require.Nil(t, err)
+	output, err := transformer.Handle(context.Background(), Input{Message: string(raw)})
+	require.Nil(t, err)
+	assert.Equal(t, Output{Disposition: DispositionUnsupported}, output)
+}
+
+func TestTransformerComponentFilter(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Nil(t, transformer.Filter)
+
+	conf.Filter.ExcludeAccounts = []string{"123456789012"}
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Equal(t, &EventFilter{ExcludeAccounts: []string{"123456789012"}}, transformer.Filter)
+
+	conf.Filter.IncludeChangeTypes = []string{"MODIFY"}
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestTransformerComponentTracing(t *testing.T) {
+	cmp := &TransformerComponent{LogFn: runhttp.LoggerFromContext, StatFn: runhttp.StatFromContext}
+	conf := cmp.Settings()
+	transformer, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.Nil(t, transformer.Tracer)
+
+	conf.Tracing.Exporter = "file"
+	conf.Tracing.Path = filepath.Join(t.TempDir(), "traces.json")
+	transformer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	assert.NotNil(t, transformer.Tracer)
+	assert.Nil(t, transformer.Shutdown(context.Background()))
+	assert.Nil(t, transformer.Shutdown(context.Background()))
+
+	conf.Tracing.Exporter = "JAEGER"
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
@@ -2,6 +2,9 @@ package v1
 
 import (
 	"encoding/json"
+	"errors"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
 )
 
 const (
@@ -11,6 +14,9 @@ const (
 	update = "UPDATE"
 )
 
+// configurationItemChangeNotification is the AWS Config message type of configuration item change events
+const configurationItemChangeNotification = "ConfigurationItemChangeNotification"
+
 type configurationItemDiff struct {
 	ChangedProperties map[string]json.RawMessage `json:"changedProperties"`
 	ChangeType        string                     `json:"changeType"`
@@ -52,25 +58,98 @@ type relationship struct {
 	Name         string      `json:"name"`
 }
 
+type changedStringProperty struct {
+	PreviousValue string `json:"previousValue"`
+	UpdatedValue  string `json:"updatedValue"`
+	ChangeType    string `json:"changeType"`
+}
+
+// previousStringValue returns the previous value of a scalar changed property,
+// or an empty string if the property is not part of the diff
+func previousStringValue(event awsConfigEvent, property string) (string, error) {
+	raw, ok := event.ConfigurationItemDiff.ChangedProperties[property]
+	if !ok {
+		return "", nil
+	}
+	var prop changedStringProperty
+	if err := unmarshalChangedProperty(event, property, raw, &prop); err != nil {
+		return "", err
+	}
+	return prop.PreviousValue, nil
+}
+
+// unmarshalConfiguration decodes the current configuration of the configuration item
+func unmarshalConfiguration(c configurationItem, v interface{}) error {
+	if err := json.Unmarshal(c.Configuration, v); err != nil {
+		return domain.ErrMalformedProperty{Field: "Configuration", ResourceType: c.ResourceType, Err: err}
+	}
+	return nil
+}
+
+// unmarshalChangedProperty decodes a single changed property of the configuration diff
+func unmarshalChangedProperty(event awsConfigEvent, property string, raw json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(raw, v); err != nil {
+		return domain.ErrMalformedProperty{
+			Field:        "ChangedProperties." + property,
+			ResourceType: event.ConfigurationItem.ResourceType,
+			Err:          err,
+		}
+	}
+	return nil
+}
+
+// errNoUpdatedValue is the reason given when a created or updated property has no updated value
+var errNoUpdatedValue = errors.New("no updated value was provided")
+
+// errMissingDiffValue describes a changed property which lacks the value needed to interpret it:
+// the previous value of a deleted property, or the updated value of a created or updated one
+func errMissingDiffValue(event awsConfigEvent, property string, changeType string) error {
+	if changeType == delete {
+		return domain.ErrNilPreviousValue{
+			Field:        "ChangedProperties." + property,
+			ResourceType: event.ConfigurationItem.ResourceType,
+		}
+	}
+	return domain.ErrMalformedProperty{
+		Field:        "ChangedProperties." + property,
+		ResourceType: event.ConfigurationItem.ResourceType,
+		Err:          errNoUpdatedValue,
+	}
+}
+
+// requireChangedProperty decodes a changed property which must be present in the configuration diff
+func requireChangedProperty(event awsConfigEvent, property string, v interface{}) error {
+	raw, ok := event.ConfigurationItemDiff.ChangedProperties[property]
+	if !ok {
+		return ErrMissingValue{Field: "ChangedProperties." + property, ResourceType: event.ConfigurationItem.ResourceType}
+	}
+	return unmarshalChangedProperty(event, property, raw, v)
+}
+
 func getBaseOutput(c configurationItem) (Output, error) {
 	if c.AWSAccountID == "" {
-		return Output{}, ErrMissingValue{Field: "AWSAccountID"}
+		return Output{}, ErrMissingValue{Field: "AWSAccountID", ResourceType: c.ResourceType}
 	}
 	if c.AWSRegion == "" {
-		return Output{}, ErrMissingValue{Field: "AWSRegion"}
+		return Output{}, ErrMissingValue{Field: "AWSRegion", ResourceType: c.ResourceType}
 	}
 	if c.ConfigurationItemCaptureTime == "" {
-		return Output{}, ErrMissingValue{Field: "ConfigurationItemCaptureTime"}
+		return Output{}, ErrMissingValue{Field: "ConfigurationItemCaptureTime", ResourceType: c.ResourceType}
 	}
 	if c.ResourceType == "" {
 		return Output{}, ErrMissingValue{Field: "ResourceType"}
 	}
+	// resourceName is null for resources which do not support custom names
+	resourceName, _ := c.ResourceName.(string)
 	return Output{
-		AccountID:    c.AWSAccountID,
-		ChangeTime:   c.ConfigurationItemCaptureTime,
-		Region:       c.AWSRegion,
-		ResourceType: c.ResourceType,
-		ARN:          c.ARN,
-		Tags:         c.Tags,
+		AccountID:        c.AWSAccountID,
+		ChangeTime:       c.ConfigurationItemCaptureTime,
+		Region:           c.AWSRegion,
+		ResourceType:     c.ResourceType,
+		ARN:              c.ARN,
+		ResourceID:       c.ResourceID,
+		ResourceName:     resourceName,
+		AvailabilityZone: c.AvailabilityZone,
+		Tags:             c.Tags,
 	}, nil
 }
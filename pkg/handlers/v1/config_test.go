@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/service/configservice"
@@ -96,3 +97,70 @@ func TestMissingRequiredFields(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseOutputResourceName(t *testing.T) {
+	ci := configurationItem{
+		AWSAccountID:                 "0123456789012",
+		AWSRegion:                    "us-west-2",
+		ConfigurationItemCaptureTime: "2019-02-22T20:19:20.543Z",
+		ResourceID:                   "config-test-elb",
+		ResourceName:                 "config-test-elb",
+		ResourceType:                 configservice.ResourceTypeAwsElasticLoadBalancingLoadBalancer,
+	}
+	output, err := getBaseOutput(ci)
+	require.Nil(t, err)
+	require.Equal(t, "config-test-elb", output.ResourceID)
+	require.Equal(t, "config-test-elb", output.ResourceName)
+
+	// resources without custom names have a null resourceName
+	ci.ResourceName = nil
+	output, err = getBaseOutput(ci)
+	require.Nil(t, err)
+	require.Equal(t, "", output.ResourceName)
+}
+
+func TestPreviousStringValue(t *testing.T) {
+	tc := []struct {
+		Name          string
+		Diff          configurationItemDiff
+		Expected      string
+		ExpectedError bool
+	}{
+		{
+			Name: "present",
+			Diff: configurationItemDiff{
+				ChangedProperties: map[string]json.RawMessage{
+					"ResourceId": json.RawMessage(`{"previousValue": "i-08f37101ae44e31e4", "updatedValue": null, "changeType": "DELETE"}`),
+				},
+			},
+			Expected: "i-08f37101ae44e31e4",
+		},
+		{
+			Name:     "absent",
+			Diff:     configurationItemDiff{},
+			Expected: "",
+		},
+		{
+			Name: "malformed",
+			Diff: configurationItemDiff{
+				ChangedProperties: map[string]json.RawMessage{
+					"ResourceId": json.RawMessage(`{"previousValue": 1}`),
+				},
+			},
+			ExpectedError: true,
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			value, err := previousStringValue(awsConfigEvent{ConfigurationItemDiff: tt.Diff}, "ResourceId")
+			if tt.ExpectedError {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.Expected, value)
+		})
+	}
+}
@@ -1,8 +1,7 @@
 package v1
 
 import (
-	"encoding/json"
-	"errors"
+	"sort"
 	"strings"
 	"time"
 )
@@ -14,6 +13,8 @@ type ec2Configuration struct {
 		Name string `json:"name"`
 	} `json:"state"`
 	StateTransitionReason string             `json:"stateTransitionReason"`
+	PublicIPAddress       string             `json:"publicIpAddress"`
+	PublicDNSName         string             `json:"publicDnsName"`
 	InstanceType          string             `json:"instanceType"`
 	LaunchTime            time.Time          `json:"launchTime"`
 	NetworkInterfaces     []networkInterface `json:"networkInterfaces"`
@@ -61,12 +62,22 @@ type ec2ConfigurationDiff struct {
 	ChangeType    string            `json:"changeType"`
 }
 
-type ec2ChangedPropsARN struct {
-	PreviousValue string `json:"previousValue"`
-	UpdatedValue  string `json:"updatedValue"`
-	ChangeType    string `json:"changeType"`
+// stringDiff is a changed property whose values are strings, e.g. Configuration.State.Name
+type stringDiff struct {
+	PreviousValue *string `json:"previousValue"`
+	UpdatedValue  *string `json:"updatedValue"`
+	ChangeType    string  `json:"changeType"`
 }
 
+const (
+	ec2StateName       = "Configuration.State.Name"
+	ec2PublicIPAddress = "Configuration.PublicIpAddress"
+	ec2PublicDNSName   = "Configuration.PublicDnsName"
+)
+
+// ec2StateTerminated is the state name of an instance which has been deleted
+const ec2StateTerminated = "terminated"
+
 type ec2Transformer struct{}
 
 func (t ec2Transformer) Create(event awsConfigEvent) (Output, bool, error) {
@@ -78,12 +89,13 @@ func (t ec2Transformer) Create(event awsConfigEvent) (Output, bool, error) {
 	// if a resource is created for the first time, there is no diff.
 	// just read the configuration
 	var config ec2Configuration
-	if err := json.Unmarshal(event.ConfigurationItem.Configuration, &config); err != nil {
+	if err := unmarshalConfiguration(event.ConfigurationItem, &config); err != nil {
 		return Output{}, false, err
 	}
 	change := extractEC2NetworkInfo(&config)
 	change.ChangeType = added
 	output.Changes = append(output.Changes, change)
+	output.InstanceState = config.State.Name
 	return output, false, nil
 }
 
@@ -92,16 +104,50 @@ func (t ec2Transformer) Update(event awsConfigEvent) (Output, bool, error) {
 	if err != nil {
 		return Output{}, false, err
 	}
+	// a diff without the configuration leaves the state unset
+	if len(event.ConfigurationItem.Configuration) > 0 {
+		var config ec2Configuration
+		if err := unmarshalConfiguration(event.ConfigurationItem, &config); err != nil {
+			return Output{}, false, err
+		}
+		output.InstanceState = config.State.Name
+	}
 
 	addedChange := Change{ChangeType: added}
 	deletedChange := Change{ChangeType: deleted}
 	// If an update was detected, check to see if any changes to the NetworkInterfaces occurred
 	for k, v := range event.ConfigurationItemDiff.ChangedProperties {
-		if !strings.HasPrefix(k, "Configuration.NetworkInterfaces.") {
+		switch {
+		case strings.HasPrefix(k, "Configuration.NetworkInterfaces."):
+		case k == ec2StateName, k == ec2PublicIPAddress, k == ec2PublicDNSName:
+			// an auto-assigned public IP address is released when the instance stops and a new
+			// one is assigned when it starts, which is not always reflected in the interfaces
+			var diff stringDiff
+			if err := unmarshalChangedProperty(event, k, v, &diff); err != nil {
+				return Output{}, false, err
+			}
+			if k == ec2StateName {
+				if diff.UpdatedValue != nil {
+					output.InstanceState = *diff.UpdatedValue
+				}
+				continue
+			}
+			previous, updated := &deletedChange.PublicIPAddresses, &addedChange.PublicIPAddresses
+			if k == ec2PublicDNSName {
+				previous, updated = &deletedChange.Hostnames, &addedChange.Hostnames
+			}
+			if diff.PreviousValue != nil && *diff.PreviousValue != "" {
+				*previous = appendUnique(*previous, *diff.PreviousValue)
+			}
+			if diff.UpdatedValue != nil && *diff.UpdatedValue != "" {
+				*updated = appendUnique(*updated, *diff.UpdatedValue)
+			}
+			continue
+		default:
 			continue
 		}
 		var diff networkInterfaceDiff
-		if err := json.Unmarshal(v, &diff); err != nil {
+		if err := unmarshalChangedProperty(event, k, v, &diff); err != nil {
 			return Output{}, false, err
 		}
 		ni := diff.UpdatedValue
@@ -110,15 +156,21 @@ func (t ec2Transformer) Update(event awsConfigEvent) (Output, bool, error) {
 			ni = diff.PreviousValue
 			changes = &deletedChange
 		}
+		if ni == nil {
+			return Output{}, false, errMissingDiffValue(event, k, diff.ChangeType)
+		}
 		private, public, dns := extractNetworkInterfaceInfo(ni)
 		changes.PrivateIPAddresses = append(changes.PrivateIPAddresses, private...)
-		changes.PublicIPAddresses = append(changes.PublicIPAddresses, public...)
-		changes.Hostnames = append(changes.Hostnames, dns...)
+		changes.PublicIPAddresses = appendUnique(changes.PublicIPAddresses, public...)
+		changes.Hostnames = appendUnique(changes.Hostnames, dns...)
+		changes.NetworkInterfaces = append(changes.NetworkInterfaces, newNetworkInterface(ni, private, public))
 	}
 
 	// We need to compute the symmetric difference of the added changes and the removed changes
 	// i.e. remove entries that show up as both added and removed
 	symmetricDifference(&addedChange, &deletedChange)
+	retainChangedInterfaces(&addedChange)
+	retainChangedInterfaces(&deletedChange)
 	if len(addedChange.PrivateIPAddresses) > 0 || len(addedChange.PublicIPAddresses) > 0 || len(addedChange.Hostnames) > 0 {
 		output.Changes = append(output.Changes, addedChange)
 	}
@@ -134,38 +186,31 @@ func (t ec2Transformer) Delete(event awsConfigEvent) (Output, bool, error) {
 		return Output{}, false, err
 	}
 
-	// if a resource is deleted, the tags are no longer present in the base object.
-	// we must fetch them from the previous configuration.
-	changeProps := event.ConfigurationItemDiff.ChangedProperties
-
-	if output.ARN == "" {
-		previousARNRaw, ok := changeProps["ARN"]
-		if !ok {
-			return Output{}, false, ErrMissingValue{Field: "ARN"}
-		}
-		var changedPropsARN ec2ChangedPropsARN
-		if err := json.Unmarshal(previousARNRaw, &changedPropsARN); err != nil {
-			return Output{}, false, err
-		}
-		output.ARN = changedPropsARN.PreviousValue
-	}
-
-	configDiffRaw, ok := changeProps["Configuration"]
-	if !ok {
-		return Output{}, false, errors.New("Invalid configuration diff")
-	}
+	// the ARN and tags of a deleted instance are recovered from the diff by recoverDeletedResource
 	var configDiff ec2ConfigurationDiff
-	if err := json.Unmarshal(configDiffRaw, &configDiff); err != nil {
+	if err := requireChangedProperty(event, "Configuration", &configDiff); err != nil {
 		return Output{}, false, err
 	}
-	for _, tag := range configDiff.PreviousValue.Tags {
-		output.Tags[tag.Key] = tag.Value
-	}
 
 	// fetch network information from the previous configuration
+	if configDiff.PreviousValue == nil {
+		return Output{}, false, errMissingDiffValue(event, "Configuration", delete)
+	}
 	change := extractEC2NetworkInfo(configDiff.PreviousValue)
 	change.ChangeType = deleted
 	output.Changes = append(output.Changes, change)
+
+	// AWS Config blanks the configuration of a deleted instance, which is then terminated
+	output.InstanceState = ec2StateTerminated
+	if len(event.ConfigurationItem.Configuration) > 0 {
+		var config ec2Configuration
+		if err := unmarshalConfiguration(event.ConfigurationItem, &config); err != nil {
+			return Output{}, false, err
+		}
+		if config.State.Name != "" {
+			output.InstanceState = config.State.Name
+		}
+	}
 	return output, false, nil
 }
 
@@ -184,6 +229,37 @@ func symmetricDifference(a, b *Change) {
 	b.Hostnames = sliceDiff(b.Hostnames, aHostnames)
 }
 
+// appendUnique appends the values which are not already in the slice
+func appendUnique(values []string, more ...string) []string {
+	for _, v := range more {
+		found := false
+		for _, existing := range values {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// intersect returns the values of a which are also in b, or nil if there are none
+func intersect(a, b []string) []string {
+	var result []string
+	for _, v := range a {
+		for _, w := range b {
+			if v == w {
+				result = append(result, v)
+				break
+			}
+		}
+	}
+	return result
+}
+
 func sliceDiff(a, b []string) []string {
 	m := make(map[string]bool)
 	diff := []string{}
@@ -207,10 +283,50 @@ func extractEC2NetworkInfo(config *ec2Configuration) Change {
 		change.PrivateIPAddresses = append(change.PrivateIPAddresses, private...)
 		change.PublicIPAddresses = append(change.PublicIPAddresses, public...)
 		change.Hostnames = append(change.Hostnames, dns...)
+		change.NetworkInterfaces = append(change.NetworkInterfaces, newNetworkInterface(&config.NetworkInterfaces[i], private, public))
 	}
 	return change
 }
 
+func newNetworkInterface(ni *networkInterface, private, public []string) NetworkInterface {
+	// the addresses of an interface are omitted rather than empty when there are none
+	if len(private) == 0 {
+		private = nil
+	}
+	if len(public) == 0 {
+		public = nil
+	}
+	return NetworkInterface{
+		NetworkInterfaceID: ni.NetworkInterfaceID,
+		SubnetID:           ni.SubnetID,
+		VpcID:              ni.VpcID,
+		PrivateDNSName:     ni.PrivateDNSName,
+		PrivateIPAddresses: private,
+		PublicIPAddresses:  public,
+	}
+}
+
+// retainChangedInterfaces keeps only the addresses of each network interface which are
+// still part of the change, and drops the interfaces which have none left. The changed
+// properties are not ordered, so the interfaces are sorted by ID.
+func retainChangedInterfaces(change *Change) {
+	sort.SliceStable(change.NetworkInterfaces, func(i, j int) bool {
+		return change.NetworkInterfaces[i].NetworkInterfaceID < change.NetworkInterfaces[j].NetworkInterfaceID
+	})
+	interfaces := change.NetworkInterfaces[:0]
+	for _, ni := range change.NetworkInterfaces {
+		ni.PrivateIPAddresses = intersect(ni.PrivateIPAddresses, change.PrivateIPAddresses)
+		ni.PublicIPAddresses = intersect(ni.PublicIPAddresses, change.PublicIPAddresses)
+		if len(ni.PrivateIPAddresses) > 0 || len(ni.PublicIPAddresses) > 0 {
+			interfaces = append(interfaces, ni)
+		}
+	}
+	if len(interfaces) == 0 {
+		interfaces = nil
+	}
+	change.NetworkInterfaces = interfaces
+}
+
 // extracts privateIPAddresses, publicIPAddresses, and public DNS names
 func extractNetworkInterfaceInfo(ni *networkInterface) ([]string, []string, []string) {
 	privateIPAddresses := []string{}
@@ -1,11 +1,44 @@
 package v1
 
 import (
-	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/configservice"
 )
 
 type elbConfiguration struct {
 	DNSName string `json:"dnsname"`
+	Scheme  string `json:"scheme"`
+
+	// the remaining fields are only read for classic ELBs
+	ListenerDescriptions []elbListenerDescription `json:"listenerDescriptions"`
+	Instances            []elbInstance            `json:"instances"`
+}
+
+type elbListenerDescription struct {
+	Listener struct {
+		Protocol         string `json:"protocol"`
+		LoadBalancerPort int    `json:"loadBalancerPort"`
+		InstanceProtocol string `json:"instanceProtocol"`
+		InstancePort     int    `json:"instancePort"`
+	} `json:"listener"`
+}
+
+type elbInstance struct {
+	InstanceID string `json:"instanceId"`
+}
+
+type elbListenerDescriptionDiff struct {
+	PreviousValue *elbListenerDescription `json:"previousValue"`
+	UpdatedValue  *elbListenerDescription `json:"updatedValue"`
+	ChangeType    string                  `json:"changeType"`
+}
+
+type elbInstanceDiff struct {
+	PreviousValue *elbInstance `json:"previousValue"`
+	UpdatedValue  *elbInstance `json:"updatedValue"`
+	ChangeType    string       `json:"changeType"`
 }
 
 type elbConfigurationDiff struct {
@@ -26,6 +59,42 @@ func extractELBNetworkInfo(config *elbConfiguration) Change {
 	}
 }
 
+// extractClassicELBNetworkInfo adds the exposed ports and the registered instances of a
+// classic ELB to its DNS name
+func extractClassicELBNetworkInfo(output Output, config *elbConfiguration) Change {
+	change := extractELBNetworkInfo(config)
+	for _, description := range config.ListenerDescriptions {
+		change.Listeners = append(change.Listeners, newListener(description))
+	}
+	for _, instance := range config.Instances {
+		change.RelatedResources = append(change.RelatedResources, instanceARN(output, instance.InstanceID))
+	}
+	return change
+}
+
+func newListener(description elbListenerDescription) Listener {
+	return Listener{
+		Protocol:         description.Listener.Protocol,
+		Port:             description.Listener.LoadBalancerPort,
+		InstanceProtocol: description.Listener.InstanceProtocol,
+		InstancePort:     description.Listener.InstancePort,
+	}
+}
+
+// instanceARN returns the ARN of an EC2 instance in the account and region of the output
+func instanceARN(output Output, instanceID string) string {
+	return synthesiseARN(Output{
+		ResourceType: configservice.ResourceTypeAwsEc2Instance,
+		ResourceID:   instanceID,
+		AccountID:    output.AccountID,
+		Region:       output.Region,
+	})
+}
+
+func isClassicELB(event awsConfigEvent) bool {
+	return event.ConfigurationItem.ResourceType == configservice.ResourceTypeAwsElasticLoadBalancingLoadBalancer
+}
+
 type elbTransformer struct{}
 
 func (t elbTransformer) Create(event awsConfigEvent) (Output, bool, error) {
@@ -37,59 +106,171 @@ func (t elbTransformer) Create(event awsConfigEvent) (Output, bool, error) {
 	// if a resource is created for the first time, there is no diff.
 	// just read the configuration
 	var config elbConfiguration
-	if err := json.Unmarshal(event.ConfigurationItem.Configuration, &config); err != nil {
+	if err := unmarshalConfiguration(event.ConfigurationItem, &config); err != nil {
 		return Output{}, false, err
 	}
 	change := extractELBNetworkInfo(&config)
+	if isClassicELB(event) {
+		change = extractClassicELBNetworkInfo(output, &config)
+	}
+	output.Scheme = config.Scheme
 	change.ChangeType = added
 	output.Changes = append(output.Changes, change)
 	return output, false, nil
 }
 
 func (t elbTransformer) Update(event awsConfigEvent) (Output, bool, error) {
-	// DNS names for ELBs cannot be changed, so the update case is a largely a no-op.
+	// DNS names for ELBs cannot be changed, so the update case is a no-op for ALBs.
 	output, err := getBaseOutput(event.ConfigurationItem)
 	if err != nil {
 		return Output{}, false, err
 	}
+	// the scheme is informational, so a configuration which cannot be read only leaves it unset
+	var config elbConfiguration
+	if unmarshalConfiguration(event.ConfigurationItem, &config) == nil {
+		output.Scheme = config.Scheme
+	}
+	// a change of scheme moves the DNS name between the internet and the VPC, so the
+	// hostname is emitted again under the new scheme
+	var hostnames []string
+	if raw, ok := event.ConfigurationItemDiff.ChangedProperties["Configuration.Scheme"]; ok {
+		var diff stringDiff
+		if err := unmarshalChangedProperty(event, "Configuration.Scheme", raw, &diff); err != nil {
+			return Output{}, false, err
+		}
+		if diff.UpdatedValue != nil {
+			output.Scheme = *diff.UpdatedValue
+			if config.DNSName != "" && (diff.PreviousValue == nil || *diff.PreviousValue != *diff.UpdatedValue) {
+				hostnames = []string{config.DNSName}
+			}
+		}
+	}
+	if !isClassicELB(event) {
+		if len(hostnames) > 0 {
+			output.Changes = append(output.Changes, Change{Hostnames: hostnames, ChangeType: added})
+		}
+		return output, false, nil
+	}
+
+	addedChange := Change{Hostnames: hostnames, ChangeType: added}
+	deletedChange := Change{ChangeType: deleted}
+	for k, v := range event.ConfigurationItemDiff.ChangedProperties {
+		switch {
+		case strings.HasPrefix(k, "Configuration.ListenerDescriptions."):
+			var diff elbListenerDescriptionDiff
+			if err := unmarshalChangedProperty(event, k, v, &diff); err != nil {
+				return Output{}, false, err
+			}
+			if diff.PreviousValue == nil && diff.UpdatedValue == nil {
+				return Output{}, false, errMissingDiffValue(event, k, diff.ChangeType)
+			}
+			if diff.PreviousValue != nil {
+				deletedChange.Listeners = append(deletedChange.Listeners, newListener(*diff.PreviousValue))
+			}
+			if diff.UpdatedValue != nil {
+				addedChange.Listeners = append(addedChange.Listeners, newListener(*diff.UpdatedValue))
+			}
+		case strings.HasPrefix(k, "Configuration.Instances."):
+			var diff elbInstanceDiff
+			if err := unmarshalChangedProperty(event, k, v, &diff); err != nil {
+				return Output{}, false, err
+			}
+			if diff.PreviousValue == nil && diff.UpdatedValue == nil {
+				return Output{}, false, errMissingDiffValue(event, k, diff.ChangeType)
+			}
+			if diff.PreviousValue != nil {
+				deletedChange.RelatedResources = append(deletedChange.RelatedResources, instanceARN(output, diff.PreviousValue.InstanceID))
+			}
+			if diff.UpdatedValue != nil {
+				addedChange.RelatedResources = append(addedChange.RelatedResources, instanceARN(output, diff.UpdatedValue.InstanceID))
+			}
+		}
+	}
+
+	// a listener or instance which was only moved within the list is neither added nor deleted
+	addedListeners := addedChange.Listeners
+	addedChange.Listeners = listenerDiff(addedListeners, deletedChange.Listeners)
+	deletedChange.Listeners = listenerDiff(deletedChange.Listeners, addedListeners)
+	addedResources := addedChange.RelatedResources
+	addedChange.RelatedResources = nilIfEmpty(sliceDiff(addedResources, deletedChange.RelatedResources))
+	deletedChange.RelatedResources = nilIfEmpty(sliceDiff(deletedChange.RelatedResources, addedResources))
+	for _, change := range []Change{addedChange, deletedChange} {
+		if len(change.Hostnames) > 0 || len(change.Listeners) > 0 || len(change.RelatedResources) > 0 {
+			sortListeners(change.Listeners)
+			sort.Strings(change.RelatedResources)
+			output.Changes = append(output.Changes, change)
+		}
+	}
 	return output, false, nil
 }
 
+// listenerDiff returns the listeners of a which are not in b
+func listenerDiff(a, b []Listener) []Listener {
+	var diff []Listener
+	for _, l := range a {
+		found := false
+		for _, m := range b {
+			if l == m {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, l)
+		}
+	}
+	return diff
+}
+
+func sortListeners(listeners []Listener) {
+	sort.Slice(listeners, func(i, j int) bool {
+		if listeners[i].Port != listeners[j].Port {
+			return listeners[i].Port < listeners[j].Port
+		}
+		return listeners[i].Protocol < listeners[j].Protocol
+	})
+}
+
+func nilIfEmpty(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
 func (t elbTransformer) Delete(event awsConfigEvent) (Output, bool, error) {
 	output, err := getBaseOutput(event.ConfigurationItem)
 	if err != nil {
 		return Output{}, false, err
 	}
-	// if a resource is deleted, the tags are no longer present in the base object.
-	// we must fetch them from the previous configuration.
-	changeProps := event.ConfigurationItemDiff.ChangedProperties
-	configDiffRaw, ok := changeProps["Configuration"]
-	if !ok {
-		return Output{}, false, ErrMissingValue{Field: "ChangedProperties.Configuration"}
-	}
 	var configDiff elbConfigurationDiff
-	if err := json.Unmarshal(configDiffRaw, &configDiff); err != nil {
+	if err := requireChangedProperty(event, "Configuration", &configDiff); err != nil {
 		return Output{}, false, err
 	}
 
 	// fetch network information from the previous configuration
+	if configDiff.PreviousValue == nil {
+		return Output{}, false, errMissingDiffValue(event, "Configuration", delete)
+	}
 	change := extractELBNetworkInfo(configDiff.PreviousValue)
+	if isClassicELB(event) {
+		change = extractClassicELBNetworkInfo(output, configDiff.PreviousValue)
+	}
+	output.Scheme = configDiff.PreviousValue.Scheme
 	change.ChangeType = deleted
 	output.Changes = append(output.Changes, change)
 
 	// if a resource is deleted, the tags are no longer present in the base object.
 	// we must fetch them from the previous configuration.
-	supplementaryConfigDiffRaw, ok := changeProps["SupplementaryConfiguration.Tags"]
+	supplementaryConfigDiffRaw, ok := event.ConfigurationItemDiff.ChangedProperties["SupplementaryConfiguration.Tags"]
 	if !ok {
 		return output, false, nil
 	}
 	var supplementaryConfigDiff supplementaryConfigurationDiff
-	if err := json.Unmarshal(supplementaryConfigDiffRaw, &supplementaryConfigDiff); err != nil {
+	if err := unmarshalChangedProperty(event, "SupplementaryConfiguration.Tags", supplementaryConfigDiffRaw, &supplementaryConfigDiff); err != nil {
 		return Output{}, false, err
 	}
 
-	for _, tag := range supplementaryConfigDiff.PreviousValue {
-		output.Tags[tag.Key] = tag.Value
-	}
+	addMissingTags(&output, supplementaryConfigDiff.PreviousValue)
 	return output, false, nil
 }
@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -51,9 +52,12 @@ func TestTransformELB(t *testing.T) {
 				Changes: []Change{
 					{
 						Hostnames:  []string{"internal-config-test-elb-01234567.us-west-2.elb.amazonaws.com"},
+						Listeners:  []Listener{{Protocol: "HTTP", Port: 80, InstanceProtocol: "HTTP", InstancePort: 80}},
+						Exposure:   &Exposure{Classification: ExposurePrivate, Reasons: []string{"the load balancer scheme is internal"}},
 						ChangeType: added,
 					},
 				},
+				Scheme: "internal",
 			},
 		},
 		{
@@ -72,9 +76,12 @@ func TestTransformELB(t *testing.T) {
 				Changes: []Change{
 					{
 						Hostnames:  []string{"internal-config-test-elb-01234567.us-west-2.elb.amazonaws.com"},
+						Listeners:  []Listener{{Protocol: "HTTP", Port: 80, InstanceProtocol: "HTTP", InstancePort: 80}},
+						Exposure:   &Exposure{Classification: ExposurePrivate, Reasons: []string{"the load balancer scheme is internal"}},
 						ChangeType: deleted,
 					},
 				},
+				Scheme: "internal",
 			},
 		},
 		{
@@ -86,12 +93,14 @@ func TestTransformELB(t *testing.T) {
 				Region:       "us-west-2",
 				ARN:          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/config-test-alb/5be197427c282f61",
 				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+				Scheme:       "internal",
 				Tags: map[string]string{
 					"key1": "1",
 				},
 				Changes: []Change{
 					{
 						Hostnames:  []string{"internal-config-test-alb-012345678.us-west-2.elb.amazonaws.com"},
+						Exposure:   &Exposure{Classification: ExposurePrivate, Reasons: []string{"the load balancer scheme is internal"}},
 						ChangeType: added,
 					},
 				},
@@ -106,6 +115,7 @@ func TestTransformELB(t *testing.T) {
 				Region:       "us-west-2",
 				ARN:          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/config-test-alb/5be197427c282f61",
 				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+				Scheme:       "internal",
 				Tags: map[string]string{
 					"key1": "1",
 					"key2": "2",
@@ -113,6 +123,7 @@ func TestTransformELB(t *testing.T) {
 				Changes: []Change{
 					{
 						Hostnames:  []string{"internal-config-test-alb-012345678.us-west-2.elb.amazonaws.com"},
+						Exposure:   &Exposure{Classification: ExposurePrivate, Reasons: []string{"the load balancer scheme is internal"}},
 						ChangeType: deleted,
 					},
 				},
@@ -127,9 +138,11 @@ func TestTransformELB(t *testing.T) {
 				Region:       "us-west-2",
 				ARN:          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/config-test-alb/5be197427c282f61",
 				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+				Scheme:       "internal",
 				Changes: []Change{
 					{
 						Hostnames:  []string{"internal-config-test-alb-012345678.us-west-2.elb.amazonaws.com"},
+						Exposure:   &Exposure{Classification: ExposurePrivate, Reasons: []string{"the load balancer scheme is internal"}},
 						ChangeType: added,
 					},
 				},
@@ -173,6 +186,7 @@ func TestTransformELB(t *testing.T) {
 			assert.Equal(t, tt.ExpectedOutput.ResourceType, output.ResourceType)
 			assert.Equal(t, tt.ExpectedOutput.Tags, output.Tags)
 			assert.Equal(t, tt.ExpectedOutput.ChangeTime, output.ChangeTime)
+			assert.Equal(t, tt.ExpectedOutput.Scheme, output.Scheme)
 			assert.ElementsMatch(t, tt.ExpectedOutput.Changes, output.Changes)
 		})
 	}
@@ -291,7 +305,11 @@ func TestELBTransformerCreate(t *testing.T) {
 			},
 			ExpectedOutput: Output{},
 			ExpectError:    true,
-			ExpectedError:  &json.UnmarshalTypeError{Value: "number", Offset: 13, Type: reflect.TypeOf(""), Struct: "elbConfiguration", Field: "dnsname"},
+			ExpectedError: domain.ErrMalformedProperty{
+				Field:        "Configuration",
+				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+				Err:          &json.UnmarshalTypeError{Value: "number", Offset: 13, Type: reflect.TypeOf(""), Struct: "elbConfiguration", Field: "dnsname"},
+			},
 		},
 		{
 			Name: "elb-missing-value",
@@ -313,7 +331,7 @@ func TestELBTransformerCreate(t *testing.T) {
 			},
 			ExpectedOutput: Output{},
 			ExpectError:    true,
-			ExpectedError:  ErrMissingValue{Field: "AWSAccountID"},
+			ExpectedError:  ErrMissingValue{Field: "AWSAccountID", ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer"},
 		},
 	}
 
@@ -340,6 +358,16 @@ func TestELBTransformerCreate(t *testing.T) {
 	}
 }
 
+var classicELBItem = configurationItem{
+	AWSAccountID:                 "123456789012",
+	AWSRegion:                    "us-west-2",
+	ConfigurationItemCaptureTime: "2019-03-27T19:06:49.363Z",
+	ResourceType:                 "AWS::ElasticLoadBalancing::LoadBalancer",
+	ARN:                          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/config-test-elb",
+	Tags:                         map[string]string{},
+	Configuration:                json.RawMessage(`{"scheme":"internal","dnsname":"internal-config-test-elb-01234567.us-west-2.elb.amazonaws.com"}`),
+}
+
 func TestELBTransformerUpdate(t *testing.T) {
 	tc := []struct {
 		Name           string
@@ -368,7 +396,120 @@ func TestELBTransformerUpdate(t *testing.T) {
 			},
 			ExpectedOutput: Output{},
 			ExpectError:    true,
-			ExpectedError:  ErrMissingValue{Field: "AWSAccountID"},
+			ExpectedError:  ErrMissingValue{Field: "AWSAccountID", ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer"},
+		},
+		{
+			Name: "elb-listeners-instances-scheme",
+			Event: awsConfigEvent{
+				ConfigurationItem: classicELBItem,
+				ConfigurationItemDiff: configurationItemDiff{
+					ChangeType: update,
+					ChangedProperties: map[string]json.RawMessage{
+						"Configuration.ListenerDescriptions.0": json.RawMessage(`{"previousValue":{"listener":{"protocol":"HTTP","loadBalancerPort":80,"instanceProtocol":"HTTP","instancePort":80},"policyNames":[]},"updatedValue":{"listener":{"protocol":"HTTPS","loadBalancerPort":443,"instanceProtocol":"HTTP","instancePort":80},"policyNames":[]},"changeType":"UPDATE"}`),
+						"Configuration.Instances.0":            json.RawMessage(`{"previousValue":null,"updatedValue":{"instanceId":"i-0123456789abcdef0"},"changeType":"CREATE"}`),
+						"Configuration.Instances.1":            json.RawMessage(`{"previousValue":{"instanceId":"i-0fedcba9876543210"},"updatedValue":null,"changeType":"DELETE"}`),
+						"Configuration.Scheme":                 json.RawMessage(`{"previousValue":"internal","updatedValue":"internet-facing","changeType":"UPDATE"}`),
+					},
+				},
+			},
+			ExpectedOutput: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ARN:          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/config-test-elb",
+				ResourceType: "AWS::ElasticLoadBalancing::LoadBalancer",
+				Tags:         map[string]string{},
+				ChangeTime:   "2019-03-27T19:06:49.363Z",
+				Scheme:       "internet-facing",
+				Changes: []Change{
+					{
+						Hostnames:        []string{"internal-config-test-elb-01234567.us-west-2.elb.amazonaws.com"},
+						Listeners:        []Listener{{Protocol: "HTTPS", Port: 443, InstanceProtocol: "HTTP", InstancePort: 80}},
+						RelatedResources: []string{"arn:aws:ec2:us-west-2:123456789012:instance/i-0123456789abcdef0"},
+						ChangeType:       added,
+					},
+					{
+						Listeners:        []Listener{{Protocol: "HTTP", Port: 80, InstanceProtocol: "HTTP", InstancePort: 80}},
+						RelatedResources: []string{"arn:aws:ec2:us-west-2:123456789012:instance/i-0fedcba9876543210"},
+						ChangeType:       deleted,
+					},
+				},
+			},
+		},
+		{
+			Name: "alb-scheme",
+			Event: awsConfigEvent{
+				ConfigurationItem: configurationItem{
+					AWSAccountID:                 "123456789012",
+					AWSRegion:                    "us-west-2",
+					ConfigurationItemCaptureTime: "2019-03-27T19:06:49.363Z",
+					ResourceType:                 "AWS::ElasticLoadBalancingV2::LoadBalancer",
+					ARN:                          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/config-test-alb/5be197427c282f61",
+					Tags:                         map[string]string{},
+					Configuration:                json.RawMessage(`{"scheme":"internet-facing","dnsname":"config-test-alb-123456789.us-west-2.elb.amazonaws.com"}`),
+				},
+				ConfigurationItemDiff: configurationItemDiff{
+					ChangeType: update,
+					ChangedProperties: map[string]json.RawMessage{
+						"Configuration.Scheme": json.RawMessage(`{"previousValue":"internal","updatedValue":"internet-facing","changeType":"UPDATE"}`),
+					},
+				},
+			},
+			ExpectedOutput: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ARN:          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/config-test-alb/5be197427c282f61",
+				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+				Tags:         map[string]string{},
+				ChangeTime:   "2019-03-27T19:06:49.363Z",
+				Scheme:       "internet-facing",
+				Changes: []Change{
+					{
+						Hostnames:  []string{"config-test-alb-123456789.us-west-2.elb.amazonaws.com"},
+						ChangeType: added,
+					},
+				},
+			},
+		},
+		{
+			Name: "elb-reordered-listeners",
+			Event: awsConfigEvent{
+				ConfigurationItem: classicELBItem,
+				ConfigurationItemDiff: configurationItemDiff{
+					ChangeType: update,
+					ChangedProperties: map[string]json.RawMessage{
+						"Configuration.ListenerDescriptions.0": json.RawMessage(`{"previousValue":{"listener":{"protocol":"HTTP","loadBalancerPort":80,"instanceProtocol":"HTTP","instancePort":80},"policyNames":[]},"updatedValue":{"listener":{"protocol":"TCP","loadBalancerPort":22,"instanceProtocol":"TCP","instancePort":22},"policyNames":[]},"changeType":"UPDATE"}`),
+						"Configuration.ListenerDescriptions.1": json.RawMessage(`{"previousValue":{"listener":{"protocol":"TCP","loadBalancerPort":22,"instanceProtocol":"TCP","instancePort":22},"policyNames":[]},"updatedValue":{"listener":{"protocol":"HTTP","loadBalancerPort":80,"instanceProtocol":"HTTP","instancePort":80},"policyNames":["policy"]},"changeType":"UPDATE"}`),
+					},
+				},
+			},
+			ExpectedOutput: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ARN:          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/config-test-elb",
+				ResourceType: "AWS::ElasticLoadBalancing::LoadBalancer",
+				Tags:         map[string]string{},
+				ChangeTime:   "2019-03-27T19:06:49.363Z",
+				Scheme:       "internal",
+			},
+		},
+		{
+			Name: "elb-missing-listener-values",
+			Event: awsConfigEvent{
+				ConfigurationItem: classicELBItem,
+				ConfigurationItemDiff: configurationItemDiff{
+					ChangeType: update,
+					ChangedProperties: map[string]json.RawMessage{
+						"Configuration.ListenerDescriptions.0": json.RawMessage(`{"previousValue":null,"updatedValue":null,"changeType":"UPDATE"}`),
+					},
+				},
+			},
+			ExpectedOutput: Output{},
+			ExpectError:    true,
+			ExpectedError: domain.ErrMalformedProperty{
+				Field:        "ChangedProperties.Configuration.ListenerDescriptions.0",
+				ResourceType: "AWS::ElasticLoadBalancing::LoadBalancer",
+				Err:          errNoUpdatedValue,
+			},
 		},
 	}
 
@@ -390,6 +531,7 @@ func TestELBTransformerUpdate(t *testing.T) {
 			assert.Equal(t, tt.ExpectedOutput.ResourceType, output.ResourceType)
 			assert.Equal(t, tt.ExpectedOutput.Tags, output.Tags)
 			assert.Equal(t, tt.ExpectedOutput.ChangeTime, output.ChangeTime)
+			assert.Equal(t, tt.ExpectedOutput.Scheme, output.Scheme)
 			assert.ElementsMatch(t, tt.ExpectedOutput.Changes, output.Changes)
 		})
 	}
@@ -436,6 +578,40 @@ func TestELBTransformerDelete(t *testing.T) {
 			},
 			ExpectError: false,
 		},
+		{
+			Name: "elb-delete-nil-tags",
+			Event: awsConfigEvent{
+				ConfigurationItem: configurationItem{
+					AWSAccountID:                 "123456789012",
+					AWSRegion:                    "us-west-2",
+					ConfigurationItemCaptureTime: "2019-03-27T19:06:49.363Z",
+					ResourceType:                 "AWS::ElasticLoadBalancing::LoadBalancer",
+					ARN:                          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/config-test-elb",
+				},
+				ConfigurationItemDiff: configurationItemDiff{
+					ChangeType: delete,
+					ChangedProperties: map[string]json.RawMessage{
+						"Configuration":                   json.RawMessage(`{"previousValue":{"scheme":"internal","dnsname":"internal-config-test-elb-67410663.us-west-2.elb.amazonaws.com"},"updatedValue":null,"changeType":"DELETE"}`),
+						"SupplementaryConfiguration.Tags": json.RawMessage(`{"previousValue":[{"key":"service_name","value":"foo-bar"}],"updatedValue":null,"changeType":"DELETE"}`),
+					},
+				},
+			},
+			ExpectedOutput: Output{
+				AccountID:    "123456789012",
+				ARN:          "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/config-test-elb",
+				ResourceType: "AWS::ElasticLoadBalancing::LoadBalancer",
+				Region:       "us-west-2",
+				ChangeTime:   "2019-03-27T19:06:49.363Z",
+				Tags:         map[string]string{"service_name": "foo-bar"},
+				Changes: []Change{
+					{
+						ChangeType: "DELETED",
+						Hostnames:  []string{"internal-config-test-elb-67410663.us-west-2.elb.amazonaws.com"},
+					},
+				},
+			},
+			ExpectError: false,
+		},
 		{
 			Name: "elb-delete-missing-supplementary-config",
 			Event: awsConfigEvent{
@@ -488,7 +664,7 @@ func TestELBTransformerDelete(t *testing.T) {
 			},
 			ExpectedOutput: Output{},
 			ExpectError:    true,
-			ExpectedError:  ErrMissingValue{Field: "ChangedProperties.Configuration"},
+			ExpectedError:  ErrMissingValue{Field: "ChangedProperties.Configuration", ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer"},
 		},
 		{
 			Name: "elb-missing-value",
@@ -510,7 +686,7 @@ func TestELBTransformerDelete(t *testing.T) {
 			},
 			ExpectedOutput: Output{},
 			ExpectError:    true,
-			ExpectedError:  ErrMissingValue{Field: "AWSAccountID"},
+			ExpectedError:  ErrMissingValue{Field: "AWSAccountID", ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer"},
 		},
 		{
 			Name: "elb-unmarshall-error",
@@ -532,7 +708,11 @@ func TestELBTransformerDelete(t *testing.T) {
 			},
 			ExpectedOutput: Output{},
 			ExpectError:    true,
-			ExpectedError:  &json.UnmarshalTypeError{Value: "number", Offset: 19, Type: reflect.TypeOf(elbConfiguration{}), Struct: "elbConfigurationDiff", Field: "previousValue"},
+			ExpectedError: domain.ErrMalformedProperty{
+				Field:        "ChangedProperties.Configuration",
+				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+				Err:          &json.UnmarshalTypeError{Value: "number", Offset: 19, Type: reflect.TypeOf(elbConfiguration{}), Struct: "elbConfigurationDiff", Field: "previousValue"},
+			},
 		},
 		{
 			Name: "elb-unmarshall-supplementary-config-error",
@@ -555,7 +735,11 @@ func TestELBTransformerDelete(t *testing.T) {
 			},
 			ExpectedOutput: Output{},
 			ExpectError:    true,
-			ExpectedError:  &json.UnmarshalTypeError{Value: "number", Offset: 27, Type: reflect.TypeOf(""), Struct: "tag", Field: "previousValue.key"},
+			ExpectedError: domain.ErrMalformedProperty{
+				Field:        "ChangedProperties.SupplementaryConfiguration.Tags",
+				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+				Err:          &json.UnmarshalTypeError{Value: "number", Offset: 27, Type: reflect.TypeOf(""), Struct: "tag", Field: "previousValue.key"},
+			},
 		},
 	}
 
@@ -1,13 +1,14 @@
 package v1
 
 import (
-	"encoding/json"
-	"errors"
 	"strings"
 )
 
 const elbRequester = "amazon-elb"
 
+// eniFilterReason is the reason given for ENIs which are not requester managed by an ELB
+const eniFilterReason = "the network interface is not requester managed by an ELB"
+
 type eniConfiguration struct {
 	Description        string             `json:"description"`
 	PrivateIPAddresses []privateIPAddress `json:"privateIpAddresses"`
@@ -47,11 +48,12 @@ func (t eniTransformer) Create(event awsConfigEvent) (Output, bool, error) {
 	}
 
 	var config eniConfiguration
-	if err := json.Unmarshal(event.ConfigurationItem.Configuration, &config); err != nil {
+	if err := unmarshalConfiguration(event.ConfigurationItem, &config); err != nil {
 		return Output{}, false, err
 	}
 
 	if filter(config) {
+		output.FilterReason = eniFilterReason
 		return output, true, nil
 	}
 
@@ -78,11 +80,12 @@ func (t eniTransformer) Update(event awsConfigEvent) (Output, bool, error) {
 	}
 
 	var config eniConfiguration
-	if err := json.Unmarshal(event.ConfigurationItem.Configuration, &config); err != nil {
+	if err := unmarshalConfiguration(event.ConfigurationItem, &config); err != nil {
 		return Output{}, false, err
 	}
 
 	if filter(config) {
+		output.FilterReason = eniFilterReason
 		return output, true, nil
 	}
 
@@ -94,7 +97,7 @@ func (t eniTransformer) Update(event awsConfigEvent) (Output, bool, error) {
 			continue
 		}
 		var diff privateIPBlockDiff
-		if err := json.Unmarshal(v, &diff); err != nil {
+		if err := unmarshalChangedProperty(event, k, v, &diff); err != nil {
 			return Output{}, false, err
 		}
 		ipBlock := diff.UpdatedValue
@@ -103,6 +106,9 @@ func (t eniTransformer) Update(event awsConfigEvent) (Output, bool, error) {
 			ipBlock = diff.PreviousValue
 			changes = &deletedChange
 		}
+		if ipBlock == nil {
+			return Output{}, false, errMissingDiffValue(event, k, diff.ChangeType)
+		}
 		extractIPBlock(ipBlock, changes)
 		extractRelatedResources(&config, changes)
 	}
@@ -124,17 +130,15 @@ func (t eniTransformer) Delete(event awsConfigEvent) (Output, bool, error) {
 		return Output{}, false, err
 	}
 
-	changeProps := event.ConfigurationItemDiff.ChangedProperties
-
-	configDiffRaw, ok := changeProps["Configuration"]
-	if !ok {
-		return Output{}, false, errors.New("Invalid configuration diff")
-	}
 	var configDiff eniConfigurationDiff
-	if err := json.Unmarshal(configDiffRaw, &configDiff); err != nil {
+	if err := requireChangedProperty(event, "Configuration", &configDiff); err != nil {
 		return Output{}, false, err
 	}
+	if configDiff.PreviousValue == nil {
+		return Output{}, false, errMissingDiffValue(event, "Configuration", delete)
+	}
 	if filter(*configDiff.PreviousValue) {
+		output.FilterReason = eniFilterReason
 		return output, true, nil
 	}
 
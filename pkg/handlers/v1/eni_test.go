@@ -8,6 +8,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/runhttp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,6 +34,7 @@ func TestTransformENI(t *testing.T) {
 					{
 						PrivateIPAddresses: []string{"10.111.222.33"},
 						RelatedResources:   []string{"micros-sec-example-ELB-AAAAAA11111"},
+						Exposure:           &Exposure{Classification: ExposurePrivate, Reasons: []string{"10.111.222.33 is in the RFC 1918 range 10.0.0.0/8"}},
 						ChangeType:         added,
 					},
 				},
@@ -52,6 +55,7 @@ func TestTransformENI(t *testing.T) {
 						PrivateIPAddresses: []string{"10.111.222.138"},
 						Hostnames:          []string{"ec2-18-111-200-30.eu-central-1.compute.amazonaws.com"},
 						RelatedResources:   []string{"app/ALB-1212412/12412413"},
+						Exposure:           &Exposure{Classification: ExposurePublic, Reasons: []string{"18.111.200.30 is a public IP address", "10.111.222.138 is in the RFC 1918 range 10.0.0.0/8"}},
 						ChangeType:         added,
 					},
 				},
@@ -83,6 +87,7 @@ func TestTransformENI(t *testing.T) {
 						PrivateIPAddresses: []string{},
 						Hostnames:          []string{"ec2-54-111-25-212.us-west-1.compute.amazonaws.com"},
 						RelatedResources:   []string{"micros-sec-example-ELB-BBBBBBBB222222"},
+						Exposure:           &Exposure{Classification: ExposurePublic, Reasons: []string{"54.111.25.212 is a public IP address"}},
 						ChangeType:         added,
 					},
 				},
@@ -103,6 +108,7 @@ func TestTransformENI(t *testing.T) {
 						PrivateIPAddresses: []string{"10.23.24.25"},
 						Hostnames:          []string{},
 						RelatedResources:   []string{"micros-sec-example-ELB-AAAAAAAABBBBBBB111111"},
+						Exposure:           &Exposure{Classification: ExposurePrivate, Reasons: []string{"10.23.24.25 is in the RFC 1918 range 10.0.0.0/8"}},
 						ChangeType:         deleted,
 					},
 				},
@@ -121,6 +127,7 @@ func TestTransformENI(t *testing.T) {
 					{
 						PrivateIPAddresses: []string{"10.11.22.33"},
 						RelatedResources:   []string{"app/marketp-ALB-eeeeeee5555555/ffffffff66666666"},
+						Exposure:           &Exposure{Classification: ExposurePrivate, Reasons: []string{"10.11.22.33 is in the RFC 1918 range 10.0.0.0/8"}},
 						ChangeType:         deleted,
 					},
 				},
@@ -141,6 +148,7 @@ func TestTransformENI(t *testing.T) {
 						PrivateIPAddresses: []string{"10.13.56.162"},
 						Hostnames:          []string{"ec2-18-123-152-102.eu-central-1.compute.amazonaws.com"},
 						RelatedResources:   []string{"app/marketp-ALB-fadg3t3t55555/gggggggg99999999"},
+						Exposure:           &Exposure{Classification: ExposurePublic, Reasons: []string{"18.123.152.102 is a public IP address", "10.13.56.162 is in the RFC 1918 range 10.0.0.0/8"}},
 						ChangeType:         deleted,
 					},
 				},
@@ -177,6 +185,55 @@ func TestTransformENI(t *testing.T) {
 	}
 }
 
+func TestENIDeleteRecoversTags(t *testing.T) {
+	event := awsConfigEvent{
+		ConfigurationItem: configurationItem{
+			AWSAccountID:                 "123456789123",
+			AWSRegion:                    "eu-central-1",
+			ConfigurationItemCaptureTime: "2021-11-05T00:00:07.736Z",
+			ResourceType:                 "AWS::EC2::NetworkInterface",
+			ResourceID:                   "eni-abcd1234",
+			ARN:                          "arn:aws:ec2:eu-central-1:123456789123:network-interface/eni-abcd1234",
+		},
+		ConfigurationItemDiff: configurationItemDiff{
+			ChangeType: delete,
+			ChangedProperties: map[string]json.RawMessage{
+				"Configuration": json.RawMessage(`{"previousValue": {"description": "ELB app/marketp-ALB-fadg3t3t55555/gggggggg99999999", "privateIpAddresses": [{"privateIpAddress": "10.13.56.162"}], "requesterId": "amazon-elb", "requesterManaged": true, "tagSet": [{"key": "service_name", "value": "foo-bar"}]}, "updatedValue": null, "changeType": "DELETE"}`),
+			},
+		},
+	}
+
+	output, reject, err := transformOutput(event, eniTransformer{})
+	require.Nil(t, err)
+	assert.False(t, reject)
+	assert.Equal(t, map[string]string{"service_name": "foo-bar"}, output.Tags)
+}
+
+func TestTransformFilteredENIDisposition(t *testing.T) {
+	event := awsConfigEvent{
+		ConfigurationItem: configurationItem{
+			AWSAccountID:                 "123456789123",
+			AWSRegion:                    "eu-central-1",
+			ConfigurationItemCaptureTime: "2021-11-05T00:00:07.736Z",
+			ResourceType:                 "AWS::EC2::NetworkInterface",
+			ResourceID:                   "eni-abcd1234",
+			ARN:                          "arn:aws:ec2:eu-central-1:123456789123:network-interface/eni-abcd1234",
+			Configuration:                json.RawMessage(`{"description": "Primary network interface", "privateIpAddresses": [{"privateIpAddress": "10.13.56.162"}], "requesterManaged": false}`),
+		},
+		ConfigurationItemDiff: configurationItemDiff{ChangeType: create},
+	}
+	raw, err := json.Marshal(event)
+	require.Nil(t, err)
+
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext}
+	output, err := transformer.Handle(context.Background(), Input{Message: string(raw)})
+	require.Nil(t, err)
+	assert.Equal(t, event.ConfigurationItem.ARN, output.ARN)
+	assert.Empty(t, output.Changes)
+	assert.Equal(t, DispositionFiltered, output.Disposition)
+	assert.Equal(t, eniFilterReason, output.FilterReason)
+}
+
 func TestFilterENI(t *testing.T) {
 	filteredConfig := eniConfiguration{
 		Description:        "ELB app/never-used",
@@ -288,19 +345,19 @@ func TestErrorENI(t *testing.T) {
 	t.Run("malformed-create-event", func(t *testing.T) {
 		_, _, err := transformer.Create(malformedConfigEvent)
 		assert.NotNil(t, err)
-		assert.Equal(t, err, ErrMissingValue{Field: "AWSAccountID"})
+		assert.Equal(t, err, ErrMissingValue{Field: "AWSAccountID", ResourceType: "AWS::EC2::NetworkInterface"})
 	})
 
 	t.Run("malformed-update-event", func(t *testing.T) {
 		_, _, err := transformer.Update(malformedConfigEvent)
 		assert.NotNil(t, err)
-		assert.Equal(t, err, ErrMissingValue{Field: "AWSAccountID"})
+		assert.Equal(t, err, ErrMissingValue{Field: "AWSAccountID", ResourceType: "AWS::EC2::NetworkInterface"})
 	})
 
 	t.Run("malformed-delete-event", func(t *testing.T) {
 		_, _, err := transformer.Delete(malformedConfigEvent)
 		assert.NotNil(t, err)
-		assert.Equal(t, err, ErrMissingValue{Field: "AWSAccountID"})
+		assert.Equal(t, err, ErrMissingValue{Field: "AWSAccountID", ResourceType: "AWS::EC2::NetworkInterface"})
 	})
 
 	// We would like this to pass evaluation so we can instead test unmarshaling errors for configs
@@ -319,7 +376,11 @@ func TestErrorENI(t *testing.T) {
 		malformedConfigEvent.ConfigurationItem.Configuration = malformedConfiguration
 		_, _, err := transformer.Create(malformedConfigEvent)
 		assert.NotNil(t, err)
-		expected := &json.UnmarshalTypeError{Value: "string", Offset: 27, Type: reflect.TypeOf(false), Struct: "eniConfiguration", Field: "requesterManaged"}
+		expected := domain.ErrMalformedProperty{
+			Field:        "Configuration",
+			ResourceType: "AWS::EC2::NetworkInterface",
+			Err:          &json.UnmarshalTypeError{Value: "string", Offset: 27, Type: reflect.TypeOf(false), Struct: "eniConfiguration", Field: "requesterManaged"},
+		}
 		assert.Equal(t, expected, err)
 	})
 
@@ -331,7 +392,11 @@ func TestErrorENI(t *testing.T) {
 		}
 		_, _, err := transformer.Delete(malformedConfigEvent)
 		assert.NotNil(t, err)
-		expected := &json.UnmarshalTypeError{Value: "string", Offset: 23, Type: reflect.TypeOf(eniConfiguration{}), Struct: "eniConfigurationDiff", Field: "previousValue"}
+		expected := domain.ErrMalformedProperty{
+			Field:        "ChangedProperties.Configuration",
+			ResourceType: "AWS::EC2::NetworkInterface",
+			Err:          &json.UnmarshalTypeError{Value: "string", Offset: 23, Type: reflect.TypeOf(eniConfiguration{}), Struct: "eniConfigurationDiff", Field: "previousValue"},
+		}
 		assert.Equal(t, expected, err)
 	})
 
@@ -359,7 +424,11 @@ func TestErrorENI(t *testing.T) {
 
 		_, _, err := transformer.Update(malformedEvent)
 		assert.NotNil(t, err)
-		expected := &json.UnmarshalTypeError{Value: "string", Type: reflect.TypeOf(privateIPAddress{}), Offset: 23, Struct: "privateIPBlockDiff", Field: "previousValue"}
+		expected := domain.ErrMalformedProperty{
+			Field:        "ChangedProperties.Configuration.PrivateIpAddresses.0",
+			ResourceType: "AWS::EC2::NetworkInterface",
+			Err:          &json.UnmarshalTypeError{Value: "string", Type: reflect.TypeOf(privateIPAddress{}), Offset: 23, Struct: "privateIPBlockDiff", Field: "previousValue"},
+		}
 		assert.Equal(t, expected, err)
 	})
 }
@@ -1,12 +1,9 @@
 package v1
 
-import "fmt"
+import "github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
 
 // ErrMissingValue is returned when a configuration item is missing a required field
-type ErrMissingValue struct {
-	Field string
-}
+type ErrMissingValue = domain.ErrMissingValue
 
-func (e ErrMissingValue) Error() string {
-	return fmt.Sprintf("no field %s was provided", e.Field)
-}
+// ErrSchemaViolation is returned when a transformed output does not conform to the published JSON Schema
+type ErrSchemaViolation = domain.ErrSchemaViolation
@@ -0,0 +1,147 @@
+package v1
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	// ExposurePublic classifies changes with addresses reachable from the internet
+	ExposurePublic = "PUBLIC"
+	// ExposurePrivate classifies changes with addresses only reachable from private networks
+	ExposurePrivate = "PRIVATE"
+	// ExposureUnknown classifies changes without any address which could be classified
+	ExposureUnknown = "UNKNOWN"
+)
+
+const (
+	schemeInternetFacing = "internet-facing"
+	schemeInternal       = "internal"
+)
+
+// Exposure classifies whether the addresses of a change are reachable from the internet
+type Exposure struct {
+	// Classification is "PUBLIC", "PRIVATE" or "UNKNOWN" (required)
+	Classification string `json:"classification" schema:"enum=PUBLIC|PRIVATE|UNKNOWN"`
+
+	// Reasons explain the classification, one per classified address (required)
+	Reasons []string `json:"reasons"`
+}
+
+type namedRange struct {
+	name    string
+	network *net.IPNet
+}
+
+// privateRanges are the address ranges which are not routable on the internet
+var privateRanges = []namedRange{
+	{name: "RFC 1918", network: mustParseCIDR("10.0.0.0/8")},
+	{name: "RFC 1918", network: mustParseCIDR("172.16.0.0/12")},
+	{name: "RFC 1918", network: mustParseCIDR("192.168.0.0/16")},
+	{name: "RFC 6598", network: mustParseCIDR("100.64.0.0/10")},
+	{name: "IPv6 ULA", network: mustParseCIDR("fc00::/7")},
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err.Error())
+	}
+	return network
+}
+
+// parseRanges parses a list of CIDR blocks
+func parseRanges(cidrs []string) ([]*net.IPNet, error) {
+	ranges := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR block %s: %s", cidr, err.Error())
+		}
+		ranges = append(ranges, network)
+	}
+	return ranges, nil
+}
+
+// classifyExposure sets the exposure of every change of the output
+func (t *Transformer) classifyExposure(output *Output) {
+	for i := range output.Changes {
+		output.Changes[i].Exposure = classifyExposure(output.Changes[i], output.Scheme, t.CorporateRanges)
+	}
+}
+
+// classifyExposure classifies a change as public if any of its addresses is public, and as
+// private if it has addresses and all of them are private. Addresses in the corporate ranges
+// are publicly routable but not reachable from the internet, so they are private.
+// Every change of a load balancer is classified by its scheme, including changes of its
+// listeners, instances or tags which carry no hostname. Only load balancers have a scheme.
+func classifyExposure(change Change, scheme string, corporateRanges []*net.IPNet) *Exposure {
+	var public, private []string
+	addresses := make([]string, 0, len(change.PublicIPAddresses)+len(change.PrivateIPAddresses))
+	addresses = append(addresses, change.PublicIPAddresses...)
+	addresses = append(addresses, change.PrivateIPAddresses...)
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+		network := &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		if reason, ok := privateReason(address, network, corporateRanges); ok {
+			private = append(private, reason)
+			continue
+		}
+		public = append(public, fmt.Sprintf("%s is a public IP address", address))
+	}
+	if _, network, err := net.ParseCIDR(change.CIDRBlock); err == nil {
+		if reason, ok := privateReason(change.CIDRBlock, network, corporateRanges); ok {
+			private = append(private, reason)
+		} else {
+			public = append(public, fmt.Sprintf("%s is a public CIDR block", change.CIDRBlock))
+		}
+	}
+	switch scheme {
+	case schemeInternetFacing:
+		public = append(public, "the load balancer scheme is internet-facing")
+	case schemeInternal:
+		private = append(private, "the load balancer scheme is internal")
+	}
+
+	switch {
+	case len(public) > 0:
+		return &Exposure{Classification: ExposurePublic, Reasons: append(public, private...)}
+	case len(private) > 0:
+		return &Exposure{Classification: ExposurePrivate, Reasons: private}
+	}
+	return &Exposure{
+		Classification: ExposureUnknown,
+		Reasons:        []string{"the change has no IP address, CIDR block or load balancer scheme"},
+	}
+}
+
+// privateReason explains why the network is private, if it lies within a corporate or private range
+func privateReason(address string, network *net.IPNet, corporateRanges []*net.IPNet) (string, bool) {
+	for _, r := range corporateRanges {
+		if withinRange(network, r) {
+			return fmt.Sprintf("%s is in the corporate range %s", address, r.String()), true
+		}
+	}
+	for _, r := range privateRanges {
+		if withinRange(network, r.network) {
+			return fmt.Sprintf("%s is in the %s range %s", address, r.name, r.network.String()), true
+		}
+	}
+	return "", false
+}
+
+// withinRange reports whether the network lies entirely within the range
+func withinRange(network *net.IPNet, r *net.IPNet) bool {
+	ones, bits := network.Mask.Size()
+	rangeOnes, rangeBits := r.Mask.Size()
+	if (network.IP.To4() == nil) != (r.IP.To4() == nil) {
+		return false
+	}
+	if bits-ones > rangeBits-rangeOnes {
+		return false
+	}
+	return r.Contains(network.IP)
+}
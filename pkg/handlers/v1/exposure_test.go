@@ -0,0 +1,113 @@
+package v1
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyExposure(t *testing.T) {
+	corporateRanges := []*net.IPNet{mustParseCIDR("203.0.113.0/24")}
+	tc := []struct {
+		Name     string
+		Change   Change
+		Scheme   string
+		Expected Exposure
+	}{
+		{
+			Name:   "public-ip",
+			Change: Change{PublicIPAddresses: []string{"34.222.120.66"}, PrivateIPAddresses: []string{"172.31.30.79"}},
+			Expected: Exposure{Classification: ExposurePublic, Reasons: []string{
+				"34.222.120.66 is a public IP address",
+				"172.31.30.79 is in the RFC 1918 range 172.16.0.0/12",
+			}},
+		},
+		{
+			Name:   "private-ips",
+			Change: Change{PrivateIPAddresses: []string{"10.1.2.3", "100.64.0.1", "fd12:3456:789a::1"}},
+			Expected: Exposure{Classification: ExposurePrivate, Reasons: []string{
+				"10.1.2.3 is in the RFC 1918 range 10.0.0.0/8",
+				"100.64.0.1 is in the RFC 6598 range 100.64.0.0/10",
+				"fd12:3456:789a::1 is in the IPv6 ULA range fc00::/7",
+			}},
+		},
+		{
+			Name:     "public-ipv6",
+			Change:   Change{PrivateIPAddresses: []string{"2600:1f14::1"}},
+			Expected: Exposure{Classification: ExposurePublic, Reasons: []string{"2600:1f14::1 is a public IP address"}},
+		},
+		{
+			Name:     "corporate-range",
+			Change:   Change{PublicIPAddresses: []string{"203.0.113.10"}},
+			Expected: Exposure{Classification: ExposurePrivate, Reasons: []string{"203.0.113.10 is in the corporate range 203.0.113.0/24"}},
+		},
+		{
+			Name:     "private-cidr-block",
+			Change:   Change{CIDRBlock: "10.0.0.0/24"},
+			Expected: Exposure{Classification: ExposurePrivate, Reasons: []string{"10.0.0.0/24 is in the RFC 1918 range 10.0.0.0/8"}},
+		},
+		{
+			Name:     "cidr-block-spanning-private-range",
+			Change:   Change{CIDRBlock: "10.0.0.0/7"},
+			Expected: Exposure{Classification: ExposurePublic, Reasons: []string{"10.0.0.0/7 is a public CIDR block"}},
+		},
+		{
+			Name:     "internet-facing-load-balancer",
+			Change:   Change{Hostnames: []string{"config-test-elb-01234567.us-west-2.elb.amazonaws.com"}},
+			Scheme:   "internet-facing",
+			Expected: Exposure{Classification: ExposurePublic, Reasons: []string{"the load balancer scheme is internet-facing"}},
+		},
+		{
+			Name:     "internal-load-balancer",
+			Change:   Change{Hostnames: []string{"internal-config-test-elb-01234567.us-west-2.elb.amazonaws.com"}},
+			Scheme:   "internal",
+			Expected: Exposure{Classification: ExposurePrivate, Reasons: []string{"the load balancer scheme is internal"}},
+		},
+		{
+			Name:     "load-balancer-listeners",
+			Change:   Change{Listeners: []Listener{{Protocol: "HTTPS", Port: 443, InstanceProtocol: "HTTP", InstancePort: 80}}},
+			Scheme:   "internet-facing",
+			Expected: Exposure{Classification: ExposurePublic, Reasons: []string{"the load balancer scheme is internet-facing"}},
+		},
+		{
+			Name:     "load-balancer-tag-changes",
+			Change:   Change{TagChanges: []TagChange{{UpdatedValue: &Tag{Key: "key1", Value: "1"}}}},
+			Scheme:   "internal",
+			Expected: Exposure{Classification: ExposurePrivate, Reasons: []string{"the load balancer scheme is internal"}},
+		},
+		{
+			Name:     "tag-changes",
+			Change:   Change{TagChanges: []TagChange{{UpdatedValue: &Tag{Key: "key1", Value: "1"}}}},
+			Expected: Exposure{Classification: ExposureUnknown, Reasons: []string{"the change has no IP address, CIDR block or load balancer scheme"}},
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, &tt.Expected, classifyExposure(tt.Change, tt.Scheme, corporateRanges))
+		})
+	}
+}
+
+func TestClassifyExposureListenerUpdate(t *testing.T) {
+	item := classicELBItem
+	item.Configuration = json.RawMessage(`{"scheme":"internet-facing","dnsname":"config-test-elb-01234567.us-west-2.elb.amazonaws.com"}`)
+	event := awsConfigEvent{
+		ConfigurationItem: item,
+		ConfigurationItemDiff: configurationItemDiff{
+			ChangeType: update,
+			ChangedProperties: map[string]json.RawMessage{
+				"Configuration.ListenerDescriptions.1": json.RawMessage(`{"previousValue":null,"updatedValue":{"listener":{"protocol":"TCP","loadBalancerPort":22,"instanceProtocol":"TCP","instancePort":22},"policyNames":[]},"changeType":"CREATE"}`),
+			},
+		},
+	}
+	output, _, err := elbTransformer{}.Update(event)
+	require.Nil(t, err)
+	(&Transformer{}).classifyExposure(&output)
+	require.Len(t, output.Changes, 1)
+	assert.Empty(t, output.Changes[0].Hostnames)
+	assert.Equal(t, &Exposure{Classification: ExposurePublic, Reasons: []string{"the load balancer scheme is internet-facing"}}, output.Changes[0].Exposure)
+}
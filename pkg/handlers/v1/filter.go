@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// FilterConfig is the configuration of the rules which filter events before they are emitted.
+type FilterConfig struct {
+	IncludeResourceTypes []string `description:"Resource types of the events which are emitted. All resource types are emitted when empty."`
+	ExcludeResourceTypes []string `description:"Resource types of the events which are filtered."`
+	IncludeAccounts      []string `description:"Account IDs of the events which are emitted. All accounts are emitted when empty."`
+	ExcludeAccounts      []string `description:"Account IDs of the events which are filtered."`
+	IncludeRegions       []string `description:"Regions of the events which are emitted. All regions are emitted when empty."`
+	ExcludeRegions       []string `description:"Regions of the events which are filtered."`
+	IncludeTags          []string `description:"Tags of the resources whose events are emitted, as key or key=value. All resources are emitted when empty."`
+	ExcludeTags          []string `description:"Tags of the resources whose events are filtered, as key or key=value."`
+	IncludeChangeTypes   []string `description:"Change types of the events which are emitted. One or more of CREATE, UPDATE or DELETE. All change types are emitted when empty."`
+	ExcludeChangeTypes   []string `description:"Change types of the events which are filtered. One or more of CREATE, UPDATE or DELETE."`
+}
+
+// Name of the configuration root.
+func (*FilterConfig) Name() string {
+	return "filter"
+}
+
+// Description returns the help information for the configuration root.
+func (*FilterConfig) Description() string {
+	return "Rules which filter events by resource type, account, region, tag and change type."
+}
+
+// EventFilter holds the rules which filter events before they are emitted. Every list of
+// included values which is not empty must contain a value of the event, and an event with
+// a value in any list of excluded values is filtered.
+type EventFilter struct {
+	IncludeResourceTypes []string
+	ExcludeResourceTypes []string
+	IncludeAccounts      []string
+	ExcludeAccounts      []string
+	IncludeRegions       []string
+	ExcludeRegions       []string
+	IncludeTags          []string
+	ExcludeTags          []string
+	IncludeChangeTypes   []string
+	ExcludeChangeTypes   []string
+}
+
+// empty reports whether the filter has no rules
+func (f EventFilter) empty() bool {
+	return len(f.IncludeResourceTypes) == 0 && len(f.ExcludeResourceTypes) == 0 &&
+		len(f.IncludeAccounts) == 0 && len(f.ExcludeAccounts) == 0 &&
+		len(f.IncludeRegions) == 0 && len(f.ExcludeRegions) == 0 &&
+		len(f.IncludeTags) == 0 && len(f.ExcludeTags) == 0 &&
+		len(f.IncludeChangeTypes) == 0 && len(f.ExcludeChangeTypes) == 0
+}
+
+// validate checks the change types of the filter
+func (f EventFilter) validate() error {
+	for _, changeType := range append(append([]string{}, f.IncludeChangeTypes...), f.ExcludeChangeTypes...) {
+		switch strings.ToUpper(changeType) {
+		case create, update, delete:
+		default:
+			return fmt.Errorf("unknown change type %s", changeType)
+		}
+	}
+	return nil
+}
+
+// match returns the rule which filters the event, described by the output of the
+// transformation, and the reason it is filtered. The rule is empty if the event is not filtered.
+func (f EventFilter) match(event awsConfigEvent, output Output) (string, string) {
+	for _, r := range []struct {
+		rule, name, value string
+		include, exclude  []string
+		eq                func(string, string) bool
+	}{
+		{"resourceType", "resource type", output.ResourceType, f.IncludeResourceTypes, f.ExcludeResourceTypes, strings.EqualFold},
+		{"account", "account", output.AccountID, f.IncludeAccounts, f.ExcludeAccounts, equal},
+		{"region", "region", output.Region, f.IncludeRegions, f.ExcludeRegions, strings.EqualFold},
+		{"changeType", "change type", event.ConfigurationItemDiff.ChangeType, f.IncludeChangeTypes, f.ExcludeChangeTypes, strings.EqualFold},
+	} {
+		if !included(r.include, r.value, r.eq) {
+			return r.rule, fmt.Sprintf("%s %s is not included", r.name, r.value)
+		}
+		if contains(r.exclude, r.value, r.eq) {
+			return r.rule, fmt.Sprintf("%s %s is excluded", r.name, r.value)
+		}
+	}
+	if len(f.IncludeTags) > 0 && !hasTag(f.IncludeTags, output.Tags) {
+		return "tag", "the resource has none of the included tags"
+	}
+	if hasTag(f.ExcludeTags, output.Tags) {
+		return "tag", "the resource has an excluded tag"
+	}
+	return "", ""
+}
+
+func equal(a, b string) bool {
+	return a == b
+}
+
+// included reports whether the value is in the list, or the list is empty
+func included(values []string, value string, eq func(string, string) bool) bool {
+	return len(values) == 0 || contains(values, value, eq)
+}
+
+func contains(values []string, value string, eq func(string, string) bool) bool {
+	for _, v := range values {
+		if eq(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTag reports whether the tags contain any of the rules, each of which is a key, or a
+// key and value separated by "="
+func hasTag(rules []string, tags map[string]string) bool {
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		value, ok := tags[parts[0]]
+		if ok && (len(parts) == 1 || parts[1] == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFilter drops the changes of an event which is filtered, counts it, and reports whether it was filtered
+func (t *Transformer) applyFilter(ctx context.Context, event awsConfigEvent, output *Output) bool {
+	rule, reason := t.Filter.match(event, *output)
+	if rule == "" {
+		return false
+	}
+	output.Changes = nil
+	output.FilterReason = reason
+	t.stat(ctx).Count("event.awsconfig.transformer.filtered", 1, "filter:"+rule)
+	return true
+}
@@ -0,0 +1,101 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventFilterMatch(t *testing.T) {
+	event := awsConfigEvent{ConfigurationItemDiff: configurationItemDiff{ChangeType: update}}
+	output := Output{
+		ResourceType: "AWS::EC2::Instance",
+		AccountID:    "123456789012",
+		Region:       "us-west-2",
+		Tags:         map[string]string{"environment": "sandbox", "service_name": "foo-bar"},
+	}
+	tc := []struct {
+		Name         string
+		Filter       EventFilter
+		ExpectedRule string
+	}{
+		{Name: "empty", Filter: EventFilter{}},
+		{Name: "included-resource-type", Filter: EventFilter{IncludeResourceTypes: []string{"aws::ec2::instance"}}},
+		{Name: "not-included-resource-type", Filter: EventFilter{IncludeResourceTypes: []string{"AWS::EC2::Subnet"}}, ExpectedRule: "resourceType"},
+		{Name: "excluded-resource-type", Filter: EventFilter{ExcludeResourceTypes: []string{"AWS::EC2::Instance"}}, ExpectedRule: "resourceType"},
+		{Name: "included-account", Filter: EventFilter{IncludeAccounts: []string{"210987654321", "123456789012"}}},
+		{Name: "not-included-account", Filter: EventFilter{IncludeAccounts: []string{"210987654321"}}, ExpectedRule: "account"},
+		{Name: "excluded-account", Filter: EventFilter{ExcludeAccounts: []string{"123456789012"}}, ExpectedRule: "account"},
+		{Name: "not-included-region", Filter: EventFilter{IncludeRegions: []string{"us-east-1"}}, ExpectedRule: "region"},
+		{Name: "excluded-region", Filter: EventFilter{ExcludeRegions: []string{"us-west-2"}}, ExpectedRule: "region"},
+		{Name: "included-tag-key", Filter: EventFilter{IncludeTags: []string{"service_name"}}},
+		{Name: "not-included-tag-value", Filter: EventFilter{IncludeTags: []string{"service_name=baz"}}, ExpectedRule: "tag"},
+		{Name: "excluded-tag-value", Filter: EventFilter{ExcludeTags: []string{"environment=sandbox"}}, ExpectedRule: "tag"},
+		{Name: "not-excluded-tag-value", Filter: EventFilter{ExcludeTags: []string{"environment=prod"}}},
+		{Name: "included-change-type", Filter: EventFilter{IncludeChangeTypes: []string{"update"}}},
+		{Name: "excluded-change-type", Filter: EventFilter{ExcludeChangeTypes: []string{"UPDATE"}}, ExpectedRule: "changeType"},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			rule, reason := tt.Filter.match(event, output)
+			assert.Equal(t, tt.ExpectedRule, rule)
+			assert.Equal(t, tt.ExpectedRule != "", reason != "")
+		})
+	}
+}
+
+func TestEventFilterValidate(t *testing.T) {
+	assert.Nil(t, EventFilter{IncludeChangeTypes: []string{"create"}, ExcludeChangeTypes: []string{"DELETE"}}.validate())
+	assert.Error(t, EventFilter{ExcludeChangeTypes: []string{"MODIFY"}}.validate())
+}
+
+func TestTransformFiltered(t *testing.T) {
+	stat := &recordingStat{}
+	transformer := &Transformer{
+		LogFn:  logFn,
+		StatFn: func(context.Context) domain.Stat { return stat },
+		Filter: &EventFilter{ExcludeAccounts: []string{"123456789012"}},
+	}
+	output, err := transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	assert.Equal(t, "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b", output.ARN)
+	assert.Empty(t, output.Changes)
+	assert.Equal(t, DispositionFiltered, output.Disposition)
+	assert.Equal(t, "account 123456789012 is excluded", output.FilterReason)
+	assert.Equal(t, float64(1), stat.counts["event.awsconfig.transformer.filtered"])
+
+	transformer.Filter = &EventFilter{ExcludeAccounts: []string{"210987654321"}}
+	output, err = transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	assert.NotEmpty(t, output.Changes)
+	assert.Equal(t, DispositionTransformed, output.Disposition)
+	assert.Empty(t, output.FilterReason)
+	assert.Equal(t, float64(1), stat.counts["event.awsconfig.transformer.filtered"])
+}
+
+func TestTransformFilteredByAliasedTag(t *testing.T) {
+	// ec2.0.json is tagged service_name, which is an alias of Service
+	normaliser, err := NewTagNormaliser([]string{"service_name=Service"}, nil)
+	require.Nil(t, err)
+	transformer := &Transformer{
+		LogFn:  logFn,
+		StatFn: runhttp.StatFromContext,
+		Tags:   normaliser,
+		Filter: &EventFilter{IncludeTags: []string{"Service=foo-bar"}},
+	}
+	output, err := transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	assert.Equal(t, DispositionTransformed, output.Disposition)
+	assert.Equal(t, "foo-bar", output.Tags["Service"])
+
+	transformer.Filter = &EventFilter{ExcludeTags: []string{"Service"}}
+	output, err = transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	assert.Equal(t, DispositionFiltered, output.Disposition)
+	assert.Equal(t, "the resource has an excluded tag", output.FilterReason)
+}
@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/quick"
+
+	"github.com/asecurityteam/runhttp"
+)
+
+// FuzzHandle is seeded with every sample notification in testdata. Run it with
+//
+//	go test ./pkg/handlers/v1 -run '^$' -fuzz FuzzHandle
+//
+// Without -fuzz only the seed corpus is exercised.
+func FuzzHandle(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		var input Input
+		if err := json.Unmarshal(data, &input); err != nil || input.Message == "" {
+			// raw configuration item notifications which are not wrapped in SNS
+			f.Add(string(data))
+			continue
+		}
+		f.Add(input.Message)
+	}
+
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext}
+	f.Fuzz(func(t *testing.T, message string) {
+		output, err := transformer.Handle(context.Background(), Input{Message: message})
+		if err != nil {
+			if !isDomainError(err) {
+				t.Fatalf("unexpected error type %T: %s", err, err)
+			}
+			return
+		}
+		// the base output is only populated for supported resource types
+		if output.ResourceType != "" {
+			if err := ValidateOutput(output); err != nil {
+				// the capture time is passed through unchanged, and flagged by the validation modes
+				if violation, ok := err.(ErrSchemaViolation); !ok || violation.Path != "changeTime" {
+					t.Fatalf("output does not conform to the schema: %s", err)
+				}
+			}
+		}
+		if ip, ok := addedAndDeletedIP(output); ok {
+			t.Fatalf("%s is both added and deleted", ip)
+		}
+	})
+}
+
+// addedAndDeletedIP returns an IP address which the output reports as both added and deleted
+func addedAndDeletedIP(output Output) (string, bool) {
+	addedIPs := map[string]bool{}
+	for _, change := range output.Changes {
+		if change.ChangeType != added {
+			continue
+		}
+		for _, ip := range append(change.PrivateIPAddresses, change.PublicIPAddresses...) {
+			addedIPs[ip] = true
+		}
+	}
+	for _, change := range output.Changes {
+		if change.ChangeType != deleted {
+			continue
+		}
+		for _, ip := range append(change.PrivateIPAddresses, change.PublicIPAddresses...) {
+			if addedIPs[ip] {
+				return ip, true
+			}
+		}
+	}
+	return "", false
+}
+
+func TestSymmetricDifferenceProperty(t *testing.T) {
+	property := func(addedIPs, deletedIPs, addedHosts, deletedHosts []string) bool {
+		a := Change{
+			PrivateIPAddresses: addedIPs,
+			PublicIPAddresses:  addedIPs,
+			Hostnames:          addedHosts,
+		}
+		b := Change{
+			PrivateIPAddresses: deletedIPs,
+			PublicIPAddresses:  deletedIPs,
+			Hostnames:          deletedHosts,
+		}
+		symmetricDifference(&a, &b)
+		return disjoint(a.PrivateIPAddresses, b.PrivateIPAddresses) &&
+			disjoint(a.PublicIPAddresses, b.PublicIPAddresses) &&
+			disjoint(a.Hostnames, b.Hostnames) &&
+			retainsUnshared(addedIPs, deletedIPs, a.PrivateIPAddresses) &&
+			retainsUnshared(deletedIPs, addedIPs, b.PrivateIPAddresses) &&
+			retainsUnshared(addedHosts, deletedHosts, a.Hostnames) &&
+			retainsUnshared(deletedHosts, addedHosts, b.Hostnames)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func disjoint(a, b []string) bool {
+	for _, v := range a {
+		if containsString(b, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// retainsUnshared reports whether every value of original which is not in other survived in result
+func retainsUnshared(original, other, result []string) bool {
+	for _, v := range original {
+		if !containsString(other, v) && !containsString(result, v) {
+			return false
+		}
+	}
+	return true
+}
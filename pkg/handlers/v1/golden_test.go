@@ -0,0 +1,124 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "regenerate the golden files in testdata/golden")
+
+// goldenResult is the recorded result of transforming a testdata input
+type goldenResult struct {
+	Output *Output      `json:"output,omitempty"`
+	Error  *goldenError `json:"error,omitempty"`
+}
+
+type goldenError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// TestGolden transforms every input in testdata and compares the result with
+// testdata/golden/<input>.out.json. New samples only need to be dropped into testdata
+// and recorded by running the tests with -update.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	require.Nil(t, err)
+	require.NotEmpty(t, files)
+
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext}
+	for _, file := range files {
+		file := file
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(file)
+			require.Nil(t, err)
+
+			var input Input
+			if err := json.Unmarshal(data, &input); err != nil || input.Message == "" {
+				// raw configuration item notifications which are not wrapped in SNS
+				input = Input{Message: string(data)}
+			}
+			output, err := transformer.Handle(context.Background(), input)
+
+			var result goldenResult
+			if err != nil {
+				result.Error = newGoldenError(err)
+			} else {
+				normaliseOutput(&output)
+				result.Output = &output
+			}
+			actual, err := json.MarshalIndent(result, "", "  ")
+			require.Nil(t, err)
+			actual = append(actual, '\n')
+
+			golden := filepath.Join("testdata", "golden", name+".out.json")
+			if *updateGolden {
+				require.Nil(t, os.MkdirAll(filepath.Dir(golden), 0755))
+				require.Nil(t, ioutil.WriteFile(golden, actual, 0644))
+			}
+			expected, err := ioutil.ReadFile(golden)
+			require.Nil(t, err, "no golden file for %s, run the tests with -update", file)
+			assert.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
+
+// newGoldenError records the type and message of an error. The message of a malformed
+// property omits the underlying decoding error, which differs between Go releases.
+func newGoldenError(err error) *goldenError {
+	var malformed domain.ErrMalformedProperty
+	if errors.As(err, &malformed) {
+		return &goldenError{
+			Type:    reflect.TypeOf(malformed).Name(),
+			Message: fmt.Sprintf("malformed property %s for %s", malformed.Field, malformed.ResourceType),
+		}
+	}
+	return &goldenError{Type: reflect.TypeOf(err).Name(), Message: err.Error()}
+}
+
+// normaliseOutput sorts the changes of an output, which are produced by iterating over
+// the changed properties of the diff in no particular order
+func normaliseOutput(output *Output) {
+	for i := range output.Changes {
+		c := &output.Changes[i]
+		sort.Strings(c.PublicIPAddresses)
+		sort.Strings(c.PrivateIPAddresses)
+		sort.Strings(c.Hostnames)
+		sort.Strings(c.RelatedResources)
+		sort.Slice(c.TagChanges, func(a, b int) bool {
+			return tagChangeKey(c.TagChanges[a]) < tagChangeKey(c.TagChanges[b])
+		})
+	}
+	sort.SliceStable(output.Changes, func(a, b int) bool {
+		x, _ := json.Marshal(output.Changes[a])
+		y, _ := json.Marshal(output.Changes[b])
+		return string(x) < string(y)
+	})
+}
+
+func tagChangeKey(tc TagChange) string {
+	var previous, updated string
+	if tc.PreviousValue != nil {
+		previous = tc.PreviousValue.Key + "=" + tc.PreviousValue.Value
+	}
+	if tc.UpdatedValue != nil {
+		updated = tc.UpdatedValue.Key + "=" + tc.UpdatedValue.Value
+	}
+	return previous + "/" + updated
+}
@@ -0,0 +1,285 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartialDiffs(t *testing.T) {
+	item := func(resourceType string) configurationItem {
+		return configurationItem{
+			AWSAccountID:                 "123456789012",
+			AWSRegion:                    "us-west-2",
+			ARN:                          "arn:aws:ec2:us-west-2:123456789012:resource/id-1234",
+			ResourceID:                   "id-1234",
+			ResourceType:                 resourceType,
+			ConfigurationItemCaptureTime: "2020-08-21T12:00:00.000Z",
+		}
+	}
+	eniItem := item("AWS::EC2::NetworkInterface")
+	eniItem.Configuration = json.RawMessage(`{"requesterManaged": true, "requesterId": "amazon-elb"}`)
+	tc := []struct {
+		Name        string
+		Transformer ResourceTransformer
+		Delete      bool
+		Event       awsConfigEvent
+		Expected    error
+	}{
+		{
+			Name:        "ec2-delete-nil-previous-configuration",
+			Transformer: &ec2Transformer{},
+			Delete:      true,
+			Event: awsConfigEvent{
+				ConfigurationItem: item("AWS::EC2::Instance"),
+				ConfigurationItemDiff: configurationItemDiff{ChangedProperties: map[string]json.RawMessage{
+					"Configuration": json.RawMessage(`{"previousValue": null, "changeType": "DELETE"}`),
+				}},
+			},
+			Expected: domain.ErrNilPreviousValue{Field: "ChangedProperties.Configuration", ResourceType: "AWS::EC2::Instance"},
+		},
+		{
+			Name:        "ec2-update-nil-updated-network-interface",
+			Transformer: &ec2Transformer{},
+			Event: awsConfigEvent{
+				ConfigurationItem: item("AWS::EC2::Instance"),
+				ConfigurationItemDiff: configurationItemDiff{ChangedProperties: map[string]json.RawMessage{
+					"Configuration.NetworkInterfaces.0": json.RawMessage(`{"updatedValue": null, "changeType": "CREATE"}`),
+				}},
+			},
+			Expected: domain.ErrMalformedProperty{
+				Field:        "ChangedProperties.Configuration.NetworkInterfaces.0",
+				ResourceType: "AWS::EC2::Instance",
+				Err:          errNoUpdatedValue,
+			},
+		},
+		{
+			Name:        "ec2-update-nil-previous-network-interface",
+			Transformer: &ec2Transformer{},
+			Event: awsConfigEvent{
+				ConfigurationItem: item("AWS::EC2::Instance"),
+				ConfigurationItemDiff: configurationItemDiff{ChangedProperties: map[string]json.RawMessage{
+					"Configuration.NetworkInterfaces.0": json.RawMessage(`{"previousValue": null, "changeType": "DELETE"}`),
+				}},
+			},
+			Expected: domain.ErrNilPreviousValue{
+				Field:        "ChangedProperties.Configuration.NetworkInterfaces.0",
+				ResourceType: "AWS::EC2::Instance",
+			},
+		},
+		{
+			Name:        "elb-delete-nil-previous-configuration",
+			Transformer: &elbTransformer{},
+			Delete:      true,
+			Event: awsConfigEvent{
+				ConfigurationItem: item("AWS::ElasticLoadBalancingV2::LoadBalancer"),
+				ConfigurationItemDiff: configurationItemDiff{ChangedProperties: map[string]json.RawMessage{
+					"Configuration": json.RawMessage(`{"previousValue": null, "changeType": "DELETE"}`),
+				}},
+			},
+			Expected: domain.ErrNilPreviousValue{
+				Field:        "ChangedProperties.Configuration",
+				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+			},
+		},
+		{
+			Name:        "eni-delete-nil-previous-configuration",
+			Transformer: &eniTransformer{},
+			Delete:      true,
+			Event: awsConfigEvent{
+				ConfigurationItem: item("AWS::EC2::NetworkInterface"),
+				ConfigurationItemDiff: configurationItemDiff{ChangedProperties: map[string]json.RawMessage{
+					"Configuration": json.RawMessage(`{"previousValue": null, "changeType": "DELETE"}`),
+				}},
+			},
+			Expected: domain.ErrNilPreviousValue{Field: "ChangedProperties.Configuration", ResourceType: "AWS::EC2::NetworkInterface"},
+		},
+		{
+			Name:        "eni-update-nil-updated-private-ip",
+			Transformer: &eniTransformer{},
+			Event: awsConfigEvent{
+				ConfigurationItem: eniItem,
+				ConfigurationItemDiff: configurationItemDiff{ChangedProperties: map[string]json.RawMessage{
+					"Configuration.PrivateIpAddresses.1": json.RawMessage(`{"updatedValue": null, "changeType": "CREATE"}`),
+				}},
+			},
+			Expected: domain.ErrMalformedProperty{
+				Field:        "ChangedProperties.Configuration.PrivateIpAddresses.1",
+				ResourceType: "AWS::EC2::NetworkInterface",
+				Err:          errNoUpdatedValue,
+			},
+		},
+		{
+			Name:        "subnet-delete-nil-previous-configuration",
+			Transformer: &subnetTransformer{},
+			Delete:      true,
+			Event: awsConfigEvent{
+				ConfigurationItem: item("AWS::EC2::Subnet"),
+				ConfigurationItemDiff: configurationItemDiff{ChangedProperties: map[string]json.RawMessage{
+					"Configuration": json.RawMessage(`{"previousValue": null, "changeType": "DELETE"}`),
+				}},
+			},
+			Expected: domain.ErrNilPreviousValue{Field: "ChangedProperties.Configuration", ResourceType: "AWS::EC2::Subnet"},
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			var err error
+			require.NotPanics(t, func() {
+				if tt.Delete {
+					_, _, err = tt.Transformer.Delete(tt.Event)
+					return
+				}
+				_, _, err = tt.Transformer.Update(tt.Event)
+			})
+			assert.Equal(t, tt.Expected, err)
+		})
+	}
+}
+
+// TestHandleMalformedVariants derives partial and malformed variants of every sample
+// notification in testdata and checks that Handle neither panics nor returns an error
+// which the gateway cannot map to a status code.
+func TestHandleMalformedVariants(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	require.Nil(t, err)
+
+	transformer := &Transformer{StatFn: runhttp.StatFromContext, LogFn: logFn}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		require.Nil(t, err)
+
+		var input Input
+		require.Nil(t, json.Unmarshal(data, &input))
+		if input.Message == "" {
+			continue
+		}
+		var message map[string]interface{}
+		if err := json.Unmarshal([]byte(input.Message), &message); err != nil {
+			// deliberately malformed messages have no structure to vary
+			continue
+		}
+
+		for name, variant := range malformedVariants(message) {
+			raw, err := json.Marshal(variant)
+			require.Nil(t, err)
+			t.Run(fmt.Sprintf("%s/%s", filepath.Base(file), name), func(t *testing.T) {
+				var err error
+				require.NotPanics(t, func() {
+					_, err = transformer.Handle(context.Background(), Input{Message: string(raw)})
+				})
+				if err != nil {
+					assert.True(t, isDomainError(err), "unexpected error type %T: %s", err, err)
+				}
+			})
+		}
+	}
+}
+
+// malformedVariants returns copies of the message in which each changed property is
+// removed, nulled, emptied or has its previous or updated value nulled, and in which
+// the configuration of the configuration item is removed, nulled or emptied
+func malformedVariants(message map[string]interface{}) map[string]map[string]interface{} {
+	variants := map[string]map[string]interface{}{}
+
+	diff, _ := message["configurationItemDiff"].(map[string]interface{})
+	properties, _ := diff["changedProperties"].(map[string]interface{})
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		mutations := map[string]func(map[string]interface{}, string) map[string]interface{}{
+			"removed":      withoutKey,
+			"null":         withValue(nil),
+			"empty":        withValue(map[string]interface{}{}),
+			"nil-updated":  withNilDiffValue("updatedValue"),
+			"nil-previous": withNilDiffValue("previousValue"),
+		}
+		for name, mutate := range mutations {
+			variant := copyJSON(message)
+			variantDiff := variant["configurationItemDiff"].(map[string]interface{})
+			variantDiff["changedProperties"] = mutate(variantDiff["changedProperties"].(map[string]interface{}), k)
+			variants[fmt.Sprintf("%s-%s", k, name)] = variant
+		}
+	}
+
+	if _, ok := message["configurationItem"].(map[string]interface{}); ok {
+		mutations := map[string]func(map[string]interface{}, string) map[string]interface{}{
+			"removed": withoutKey,
+			"null":    withValue(nil),
+			"empty":   withValue(map[string]interface{}{}),
+		}
+		for name, mutate := range mutations {
+			variant := copyJSON(message)
+			variant["configurationItem"] = mutate(variant["configurationItem"].(map[string]interface{}), "configuration")
+			variants["configuration-"+name] = variant
+		}
+	}
+	return variants
+}
+
+// withoutKey returns a copy of the object without the key. The delete builtin is
+// shadowed by the change type constant within this package.
+func withoutKey(object map[string]interface{}, key string) map[string]interface{} {
+	result := make(map[string]interface{}, len(object))
+	for k, v := range object {
+		if k != key {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func withValue(value interface{}) func(map[string]interface{}, string) map[string]interface{} {
+	return func(object map[string]interface{}, key string) map[string]interface{} {
+		object[key] = value
+		return object
+	}
+}
+
+func withNilDiffValue(field string) func(map[string]interface{}, string) map[string]interface{} {
+	return func(object map[string]interface{}, key string) map[string]interface{} {
+		if property, ok := object[key].(map[string]interface{}); ok {
+			property[field] = nil
+		}
+		return object
+	}
+}
+
+func copyJSON(v map[string]interface{}) map[string]interface{} {
+	raw, _ := json.Marshal(v)
+	var c map[string]interface{}
+	_ = json.Unmarshal(raw, &c)
+	return c
+}
+
+func isDomainError(err error) bool {
+	var (
+		missingValue     domain.ErrMissingValue
+		malformedMessage domain.ErrMalformedMessage
+		malformedProp    domain.ErrMalformedProperty
+		nilPrevious      domain.ErrNilPreviousValue
+		unsupportedType  domain.ErrUnsupportedMessageType
+		schemaViolation  domain.ErrSchemaViolation
+	)
+	return errors.As(err, &missingValue) ||
+		errors.As(err, &malformedMessage) ||
+		errors.As(err, &malformedProp) ||
+		errors.As(err, &nilPrevious) ||
+		errors.As(err, &unsupportedType) ||
+		errors.As(err, &schemaViolation)
+}
@@ -0,0 +1,99 @@
+package v1
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/asecurityteam/runhttp"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+)
+
+// outcomes of an event, as tagged on its metrics
+const (
+	outcomeTransformed = "transformed"
+	outcomeRejected    = "rejected"
+	outcomeUnsupported = "unsupported"
+	outcomeNoOp        = "no_op"
+	outcomeError       = "error"
+)
+
+const unknownTagValue = "unknown"
+
+// recordMetrics counts and times the handling of an event, tagged by its resource type,
+// change type and outcome, counts the changes it emitted, and times the lag between the
+// capture of the configuration item and the notification of the change
+func (t *Transformer) recordMetrics(ctx context.Context, event awsConfigEvent, output Output, err error, duration time.Duration) {
+	stat := t.stat(ctx)
+	resourceType := "resourceType:" + tagValue(event.ConfigurationItem.ResourceType)
+	tags := []string{
+		resourceType,
+		"changeType:" + tagValue(event.ConfigurationItemDiff.ChangeType),
+		"outcome:" + eventOutcome(output, err),
+	}
+	if err != nil {
+		tags = append(tags, "error:"+errorClass(err))
+	}
+
+	stat.Count("event.awsconfig.transformer.event", 1, tags...)
+	stat.Timing("event.awsconfig.transformer.event.duration", duration, tags...)
+	if len(output.Changes) > 0 {
+		stat.Count("event.awsconfig.transformer.changes", float64(len(output.Changes)), tags...)
+	}
+
+	notified, nerr := time.Parse(time.RFC3339Nano, event.NotificationCreationTime)
+	captured, cerr := time.Parse(time.RFC3339Nano, event.ConfigurationItem.ConfigurationItemCaptureTime)
+	if nerr == nil && cerr == nil {
+		stat.Timing("event.awsconfig.transformer.notification.lag", notified.Sub(captured), resourceType)
+	}
+}
+
+// stat returns the metrics client of the transformer. Metrics are dropped when no StatFn is
+// set, unless a client was added to the context.
+func (t *Transformer) stat(ctx context.Context) domain.Stat {
+	if t.StatFn == nil {
+		return runhttp.StatFromContext(ctx)
+	}
+	return t.StatFn(ctx)
+}
+
+// eventOutcome returns the outcome of an event from its output or error
+func eventOutcome(output Output, err error) string {
+	if err != nil {
+		return outcomeError
+	}
+	return outcome(output.Disposition)
+}
+
+// outcome returns the outcome of an event which was handled without error
+func outcome(disposition string) string {
+	switch disposition {
+	case DispositionTransformed:
+		return outcomeTransformed
+	case DispositionFiltered:
+		return outcomeRejected
+	case DispositionUnsupported:
+		return outcomeUnsupported
+	}
+	return outcomeNoOp
+}
+
+// errorClass returns the name of the type of the error, e.g. ErrMissingValue
+func errorClass(err error) string {
+	typ := reflect.TypeOf(err)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Name() == "" {
+		return unknownTagValue
+	}
+	return typ.Name()
+}
+
+func tagValue(value string) string {
+	if value == "" {
+		return unknownTagValue
+	}
+	return value
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformMetrics(t *testing.T) {
+	stat := &recordingStat{}
+	transformer := &Transformer{
+		LogFn:  logFn,
+		StatFn: func(context.Context) domain.Stat { return stat },
+	}
+
+	output, err := transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	tags := []string{"resourceType:AWS::EC2::Instance", "changeType:CREATE", "outcome:transformed"}
+	assert.Equal(t, float64(1), stat.counts["event.awsconfig.transformer.event"])
+	assert.Equal(t, tags, stat.tags["event.awsconfig.transformer.event"])
+	assert.Contains(t, stat.timings, "event.awsconfig.transformer.event.duration")
+	assert.Equal(t, tags, stat.tags["event.awsconfig.transformer.event.duration"])
+	assert.Equal(t, float64(len(output.Changes)), stat.counts["event.awsconfig.transformer.changes"])
+	assert.Equal(t, 1048*time.Millisecond, stat.timings["event.awsconfig.transformer.notification.lag"])
+	assert.Equal(t, []string{"resourceType:AWS::EC2::Instance"}, stat.tags["event.awsconfig.transformer.notification.lag"])
+
+	_, err = transformer.Handle(context.Background(), Input{Message: "{"})
+	require.Error(t, err)
+	assert.Equal(t, float64(2), stat.counts["event.awsconfig.transformer.event"])
+	assert.Equal(t,
+		[]string{"resourceType:unknown", "changeType:unknown", "outcome:error", "error:ErrMalformedMessage"},
+		stat.tags["event.awsconfig.transformer.event"],
+	)
+}
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, outcomeTransformed, outcome(DispositionTransformed))
+	assert.Equal(t, outcomeRejected, outcome(DispositionFiltered))
+	assert.Equal(t, outcomeUnsupported, outcome(DispositionUnsupported))
+	assert.Equal(t, outcomeNoOp, outcome(DispositionNoOp))
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "ErrMissingValue", errorClass(ErrMissingValue{Field: "ARN"}))
+	assert.Equal(t, "ErrStateStore", errorClass(&domain.ErrStateStore{}))
+	assert.Equal(t, "errorString", errorClass(errors.New("boom")))
+}
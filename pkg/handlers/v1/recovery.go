@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/configservice"
+)
+
+// arnResourcePrefixes maps supported resource types to the service and resource path
+// used when an ARN must be synthesised for a deleted resource.
+// Resource types whose IDs are already ARNs (e.g. ALBs) do not need an entry.
+var arnResourcePrefixes = map[string]struct {
+	Service  string
+	Resource string
+}{
+	configservice.ResourceTypeAwsEc2Instance:                      {Service: "ec2", Resource: "instance/"},
+	configservice.ResourceTypeAwsEc2NetworkInterface:              {Service: "ec2", Resource: "network-interface/"},
+	configservice.ResourceTypeAwsEc2Subnet:                        {Service: "ec2", Resource: "subnet/"},
+	configservice.ResourceTypeAwsElasticLoadBalancingLoadBalancer: {Service: "elasticloadbalancing", Resource: "loadbalancer/"},
+}
+
+// previousConfiguration holds the fields common to the previous configuration of every
+// supported resource type which are needed to describe a deleted resource
+type previousConfiguration struct {
+	// EC2 instances and subnets name their tag list "tags", ENIs name it "tagSet"
+	Tags             []tag  `json:"tags"`
+	TagSet           []tag  `json:"tagSet"`
+	AvailabilityZone string `json:"availabilityZone"`
+	Placement        struct {
+		AvailabilityZone string `json:"availabilityZone"`
+	} `json:"placement"`
+}
+
+type previousConfigurationDiff struct {
+	PreviousValue *previousConfiguration `json:"previousValue"`
+}
+
+// recoverDeletedResource fills in the identifying fields of a deleted resource which
+// AWS Config may have blanked out of the configuration item, using the previous values
+// in the diff. If AWS Config omits the ARN entirely, one is synthesised.
+func recoverDeletedResource(event awsConfigEvent, output *Output) error {
+	if output.ResourceID == "" {
+		resourceID, err := previousStringValue(event, "ResourceId")
+		if err != nil {
+			return err
+		}
+		output.ResourceID = resourceID
+	}
+
+	if output.ARN == "" {
+		arn, err := previousStringValue(event, "ARN")
+		if err != nil {
+			return err
+		}
+		if arn == "" {
+			arn = synthesiseARN(*output)
+		}
+		if arn == "" {
+			return ErrMissingValue{Field: "ARN", ResourceType: output.ResourceType}
+		}
+		output.ARN = arn
+	}
+
+	if output.AvailabilityZone == "" {
+		az, err := previousStringValue(event, "AvailabilityZone")
+		if err != nil {
+			return err
+		}
+		output.AvailabilityZone = az
+	}
+
+	configDiffRaw, ok := event.ConfigurationItemDiff.ChangedProperties["Configuration"]
+	if !ok {
+		return nil
+	}
+	var configDiff previousConfigurationDiff
+	if err := unmarshalChangedProperty(event, "Configuration", configDiffRaw, &configDiff); err != nil {
+		return err
+	}
+	if configDiff.PreviousValue == nil {
+		return nil
+	}
+	previous := configDiff.PreviousValue
+
+	if output.AvailabilityZone == "" {
+		output.AvailabilityZone = previous.AvailabilityZone
+	}
+	if output.AvailabilityZone == "" {
+		output.AvailabilityZone = previous.Placement.AvailabilityZone
+	}
+
+	// if a resource is deleted, the tags are no longer present in the base object.
+	// tags already recovered by the resource transformer take precedence.
+	addMissingTags(output, previous.Tags)
+	addMissingTags(output, previous.TagSet)
+	return nil
+}
+
+// addMissingTags copies tags into the output without overwriting existing keys
+func addMissingTags(output *Output, tags []tag) {
+	for _, t := range tags {
+		if output.Tags == nil {
+			output.Tags = make(map[string]string)
+		}
+		if _, ok := output.Tags[t.Key]; !ok {
+			output.Tags[t.Key] = t.Value
+		}
+	}
+}
+
+// synthesiseARN builds an ARN from the account, region, resource type and resource ID.
+// An empty string is returned if the resource type has no known ARN format.
+func synthesiseARN(output Output) string {
+	if strings.HasPrefix(output.ResourceID, "arn:") {
+		return output.ResourceID
+	}
+	prefix, ok := arnResourcePrefixes[output.ResourceType]
+	if !ok || output.ResourceID == "" {
+		return ""
+	}
+	return fmt.Sprintf("arn:%s:%s:%s:%s:%s%s",
+		partition(output.Region), prefix.Service, output.Region, output.AccountID, prefix.Resource, output.ResourceID)
+}
+
+// partition returns the AWS partition containing the given region
+func partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
@@ -0,0 +1,190 @@
+package v1
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverDeletedResource(t *testing.T) {
+	tc := []struct {
+		Name           string
+		Output         Output
+		Diff           configurationItemDiff
+		ExpectedOutput Output
+		ExpectError    bool
+	}{
+		{
+			Name: "arn-from-diff",
+			Output: Output{
+				AccountID:    "752631980301",
+				Region:       "us-west-2",
+				ResourceType: "AWS::EC2::Instance",
+				ResourceID:   "i-08f37101ae44e31e4",
+			},
+			Diff: configurationItemDiff{
+				ChangedProperties: map[string]json.RawMessage{
+					"ARN": json.RawMessage(`{"previousValue": "arn:aws:ec2:us-west-2:752631980301:instance/i-08f37101ae44e31e4", "updatedValue": null, "changeType": "DELETE"}`),
+				},
+			},
+			ExpectedOutput: Output{
+				AccountID:    "752631980301",
+				Region:       "us-west-2",
+				ResourceType: "AWS::EC2::Instance",
+				ResourceID:   "i-08f37101ae44e31e4",
+				ARN:          "arn:aws:ec2:us-west-2:752631980301:instance/i-08f37101ae44e31e4",
+			},
+		},
+		{
+			Name: "arn-synthesised",
+			Output: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ResourceType: "AWS::EC2::NetworkInterface",
+			},
+			Diff: configurationItemDiff{
+				ChangedProperties: map[string]json.RawMessage{
+					"ResourceId": json.RawMessage(`{"previousValue": "eni-abcd1234", "updatedValue": null, "changeType": "DELETE"}`),
+				},
+			},
+			ExpectedOutput: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ResourceType: "AWS::EC2::NetworkInterface",
+				ResourceID:   "eni-abcd1234",
+				ARN:          "arn:aws:ec2:us-west-2:123456789012:network-interface/eni-abcd1234",
+			},
+		},
+		{
+			Name: "arn-unknown-resource-type",
+			Output: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ResourceType: "AWS::S3::Bucket",
+				ResourceID:   "my-bucket",
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "availability-zone-and-tags-from-previous-configuration",
+			Output: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ResourceType: "AWS::EC2::Instance",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
+				ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				Tags:         map[string]string{"service_name": "recovered-elsewhere"},
+			},
+			Diff: configurationItemDiff{
+				ChangedProperties: map[string]json.RawMessage{
+					"Configuration": json.RawMessage(`{"previousValue": {"placement": {"availabilityZone": "us-west-2a"}, "tags": [{"key": "service_name", "value": "foo-bar"}, {"key": "business_unit", "value": "CISO-Security"}]}, "updatedValue": null, "changeType": "DELETE"}`),
+				},
+			},
+			ExpectedOutput: Output{
+				AccountID:        "123456789012",
+				Region:           "us-west-2",
+				ResourceType:     "AWS::EC2::Instance",
+				ResourceID:       "i-0a763ac3ee37d8d2b",
+				ARN:              "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				AvailabilityZone: "us-west-2a",
+				Tags: map[string]string{
+					"service_name":  "recovered-elsewhere",
+					"business_unit": "CISO-Security",
+				},
+			},
+		},
+		{
+			Name: "malformed-configuration",
+			Output: Output{
+				ARN: "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-000aa0a000a00a0aa",
+			},
+			Diff: configurationItemDiff{
+				ChangedProperties: map[string]json.RawMessage{
+					"Configuration": json.RawMessage(`{"previousValue": "bad"}`),
+				},
+			},
+			ExpectError: true,
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			output := tt.Output
+			err := recoverDeletedResource(awsConfigEvent{ConfigurationItemDiff: tt.Diff}, &output)
+			if tt.ExpectError {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tt.ExpectedOutput, output)
+		})
+	}
+}
+
+func TestSynthesiseARN(t *testing.T) {
+	tc := []struct {
+		Name     string
+		Output   Output
+		Expected string
+	}{
+		{
+			Name: "ec2-instance",
+			Output: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ResourceType: "AWS::EC2::Instance",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
+			},
+			Expected: "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+		},
+		{
+			Name: "elb-china",
+			Output: Output{
+				AccountID:    "123456789012",
+				Region:       "cn-north-1",
+				ResourceType: "AWS::ElasticLoadBalancing::LoadBalancer",
+				ResourceID:   "config-test-elb",
+			},
+			Expected: "arn:aws-cn:elasticloadbalancing:cn-north-1:123456789012:loadbalancer/config-test-elb",
+		},
+		{
+			Name: "subnet-govcloud",
+			Output: Output{
+				AccountID:    "123456789012",
+				Region:       "us-gov-west-1",
+				ResourceType: "AWS::EC2::Subnet",
+				ResourceID:   "subnet-000aa0a000a00a0aa",
+			},
+			Expected: "arn:aws-us-gov:ec2:us-gov-west-1:123456789012:subnet/subnet-000aa0a000a00a0aa",
+		},
+		{
+			Name: "alb-id-is-arn",
+			Output: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ResourceType: "AWS::ElasticLoadBalancingV2::LoadBalancer",
+				ResourceID:   "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/config-test-alb/5be197427c282f61",
+			},
+			Expected: "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/config-test-alb/5be197427c282f61",
+		},
+		{
+			Name: "missing-resource-id",
+			Output: Output{
+				AccountID:    "123456789012",
+				Region:       "us-west-2",
+				ResourceType: "AWS::EC2::Instance",
+			},
+			Expected: "",
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, synthesiseARN(tt.Output))
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SchemaVersion is the version of the published output JSON Schema. It must be
+	// incremented whenever a change to Output is not backwards compatible.
+	SchemaVersion = "v1"
+
+	schemaDraft = "http://json-schema.org/draft-07/schema#"
+	schemaID    = "https://github.com/asecurityteam/awsconfig-transformerd/schema/output." + SchemaVersion + ".json"
+)
+
+// JSONSchema is the subset of the JSON Schema (draft-07) vocabulary needed to describe Output
+type JSONSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	ID          string                 `json:"$id,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Type        schemaTypes            `json:"type,omitempty"`
+	Format      string                 `json:"format,omitempty"`
+	Enum        []string               `json:"enum,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	ValueSchema *JSONSchema            `json:"-"`
+	Closed      bool                   `json:"-"`
+}
+
+// MarshalJSON renders additionalProperties, which is either a schema for map values
+// or false for structs
+func (s JSONSchema) MarshalJSON() ([]byte, error) {
+	type plain JSONSchema
+	out := struct {
+		plain
+		AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	}{plain: plain(s)}
+	switch {
+	case s.ValueSchema != nil:
+		out.AdditionalProperties = s.ValueSchema
+	case s.Closed:
+		out.AdditionalProperties = false
+	}
+	return json.Marshal(out)
+}
+
+// schemaTypes is rendered as a single string when only one type is allowed
+type schemaTypes []string
+
+func (t schemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// OutputSchema generates the JSON Schema describing Output from the Go types.
+// Fields are required unless they are tagged omitempty, and fields which may be
+// emitted as null (nil maps, slices and pointers) are nullable. Additional
+// constraints are read from the "schema" struct tag, e.g. `schema:"enum=ADDED|DELETED"`.
+func OutputSchema() *JSONSchema {
+	s := schemaForType(reflect.TypeOf(Output{}))
+	s.Schema = schemaDraft
+	s.ID = schemaID
+	s.Title = "Schema for cloud asset change events"
+	return s
+}
+
+// SchemaHandler is a lambda handler which returns the published output JSON Schema
+func SchemaHandler(_ context.Context) (*JSONSchema, error) {
+	return OutputSchema(), nil
+}
+
+func schemaForType(t reflect.Type) *JSONSchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaForType(t.Elem())
+	case reflect.String:
+		return &JSONSchema{Type: schemaTypes{"string"}}
+	case reflect.Bool:
+		return &JSONSchema{Type: schemaTypes{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: schemaTypes{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: schemaTypes{"number"}}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: schemaTypes{"array"}, Items: schemaForType(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: schemaTypes{"object"}, ValueSchema: schemaForType(t.Elem())}
+	case reflect.Struct:
+		s := &JSONSchema{Type: schemaTypes{"object"}, Properties: map[string]*JSONSchema{}, Closed: true}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, omitEmpty := jsonFieldName(f)
+			if name == "" {
+				continue
+			}
+			fs := schemaForType(f.Type)
+			applySchemaTag(fs, f.Tag.Get("schema"))
+			if !omitEmpty {
+				s.Required = append(s.Required, name)
+				switch f.Type.Kind() {
+				case reflect.Ptr, reflect.Map, reflect.Slice:
+					fs.Type = append(fs.Type, "null")
+				}
+			}
+			s.Properties[name] = fs
+		}
+		sort.Strings(s.Required)
+		return s
+	}
+	// interface{} and other dynamic values are unconstrained
+	return &JSONSchema{}
+}
+
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	omitEmpty := false
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty
+}
+
+func applySchemaTag(s *JSONSchema, tag string) {
+	if tag == "" {
+		return
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "enum":
+			s.Enum = strings.Split(kv[1], "|")
+		case "format":
+			s.Format = kv[1]
+		}
+	}
+}
+
+// ValidateOutput checks that the JSON representation of the output conforms to OutputSchema
+func ValidateOutput(output Output) error {
+	raw, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	return validationSchema().validate("", doc)
+}
+
+var (
+	validationSchemaOnce sync.Once
+	outputSchema         *JSONSchema
+)
+
+// validationSchema returns the output schema used to validate outputs, which is generated
+// once rather than for every event. It must not be modified.
+func validationSchema() *JSONSchema {
+	validationSchemaOnce.Do(func() {
+		outputSchema = OutputSchema()
+	})
+	return outputSchema
+}
+
+func (s *JSONSchema) validate(path string, v interface{}) error {
+	if len(s.Type) > 0 && !s.allowsType(jsonType(v)) {
+		return ErrSchemaViolation{Path: path, Reason: fmt.Sprintf("expected %s but got %s", strings.Join(s.Type, " or "), jsonType(v))}
+	}
+	switch value := v.(type) {
+	case string:
+		if len(s.Enum) > 0 && !containsString(s.Enum, value) {
+			return ErrSchemaViolation{Path: path, Reason: fmt.Sprintf("%q is not one of %s", value, strings.Join(s.Enum, ", "))}
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+				return ErrSchemaViolation{Path: path, Reason: fmt.Sprintf("%q is not a date-time", value)}
+			}
+		}
+	case []interface{}:
+		if s.Items == nil {
+			return nil
+		}
+		for i, item := range value {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				return ErrSchemaViolation{Path: joinPath(path, name), Reason: "required property is missing"}
+			}
+		}
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ps, ok := s.Properties[k]
+			switch {
+			case ok:
+			case s.ValueSchema != nil:
+				ps = s.ValueSchema
+			case s.Closed:
+				return ErrSchemaViolation{Path: joinPath(path, k), Reason: "property is not allowed"}
+			default:
+				continue
+			}
+			if err := ps.validate(joinPath(path, k), value[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *JSONSchema) allowsType(t string) bool {
+	for _, allowed := range s.Type {
+		if allowed == t || (allowed == "number" && t == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+var updateSchema = flag.Bool("update-schema", false, "regenerate the published output JSON Schema")
+
+var publishedSchema = filepath.Join("..", "..", "..", "schema", "output."+SchemaVersion+".json")
+
+func TestPublishedSchema(t *testing.T) {
+	generated, err := json.MarshalIndent(OutputSchema(), "", "  ")
+	require.Nil(t, err)
+	generated = append(generated, '\n')
+
+	if *updateSchema {
+		require.Nil(t, ioutil.WriteFile(publishedSchema, generated, 0644))
+	}
+
+	published, err := ioutil.ReadFile(publishedSchema)
+	require.Nil(t, err)
+	assert.Equal(t, string(published), string(generated), "published schema is out of date, run the tests with -update-schema")
+}
+
+var apiSpecification = filepath.Join("..", "..", "..", "api.yaml")
+
+// schemaShape reduces a JSON Schema or an OpenAPI schema to the properties, types and enums
+// it declares, so that the two can be compared. Nullability, requirements, formats and
+// descriptions are left out, since OpenAPI 3.0 expresses them differently. $ref is resolved
+// against the OpenAPI components.
+func schemaShape(schema map[string]interface{}, components map[string]interface{}) map[string]interface{} {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		return schemaShape(components[name].(map[string]interface{}), components)
+	}
+	shape := map[string]interface{}{}
+	switch typ := schema["type"].(type) {
+	case string:
+		shape["type"] = typ
+	case []interface{}:
+		for _, v := range typ {
+			if v != "null" {
+				shape["type"] = v
+			}
+		}
+	}
+	if enum, ok := schema["enum"]; ok {
+		shape["enum"] = enum
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		shape["items"] = schemaShape(items, components)
+	}
+	if values, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		shape["additionalProperties"] = schemaShape(values, components)
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		shapes := map[string]interface{}{}
+		for name, property := range properties {
+			shapes[name] = schemaShape(property.(map[string]interface{}), components)
+		}
+		shape["properties"] = shapes
+	}
+	return shape
+}
+
+// TestAPISchema checks that the response schema of the API, which the gateway serves,
+// declares the same properties as the published output schema
+func TestAPISchema(t *testing.T) {
+	data, err := ioutil.ReadFile(apiSpecification)
+	require.Nil(t, err)
+	var api struct {
+		Components struct {
+			Schemas map[string]interface{} `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	require.Nil(t, yaml.Unmarshal(data, &api))
+	response, ok := api.Components.Schemas["CloudAssetChanges"].(map[string]interface{})
+	require.True(t, ok)
+
+	data, err = ioutil.ReadFile(publishedSchema)
+	require.Nil(t, err)
+	var published map[string]interface{}
+	require.Nil(t, json.Unmarshal(data, &published))
+
+	assert.Equal(t, schemaShape(published, nil), schemaShape(response, api.Components.Schemas), "the CloudAssetChanges schema of api.yaml differs from the published schema")
+}
+
+func TestSchemaHandler(t *testing.T) {
+	s, err := SchemaHandler(context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, OutputSchema(), s)
+}
+
+func TestValidateOutput(t *testing.T) {
+	valid := Output{
+		ChangeTime:   "2019-02-22T20:43:10.208Z",
+		ResourceType: "AWS::EC2::Instance",
+		AccountID:    "123456789012",
+		Region:       "us-west-2",
+		ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+		ResourceID:   "i-0a763ac3ee37d8d2b",
+		Changes: []Change{
+			{
+				PrivateIPAddresses: []string{"172.31.30.79"},
+				TagChanges:         []TagChange{{UpdatedValue: &Tag{Key: "foo", Value: "bar"}}},
+				ChangeType:         added,
+			},
+		},
+		Disposition: DispositionTransformed,
+	}
+	require.Nil(t, ValidateOutput(valid))
+
+	badTime := valid
+	badTime.ChangeTime = "yesterday"
+	err := ValidateOutput(badTime)
+	require.NotNil(t, err)
+	assert.Equal(t, "changeTime", err.(ErrSchemaViolation).Path)
+
+	badChangeType := valid
+	badChangeType.Changes = []Change{{ChangeType: "MODIFIED"}}
+	err = ValidateOutput(badChangeType)
+	require.NotNil(t, err)
+	assert.Equal(t, "changes[0].changeType", err.(ErrSchemaViolation).Path)
+
+	badDisposition := valid
+	badDisposition.Disposition = ""
+	err = ValidateOutput(badDisposition)
+	require.NotNil(t, err)
+	assert.Equal(t, "disposition", err.(ErrSchemaViolation).Path)
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := OutputSchema()
+	tc := []struct {
+		Name         string
+		Document     string
+		ExpectedPath string
+	}{
+		{
+			Name:         "missing-required",
+			Document:     `{"changeTime": "2019-02-22T20:43:10.208Z"}`,
+			ExpectedPath: "accountId",
+		},
+		{
+			Name:         "wrong-type",
+			Document:     `{"accountId": 1, "arn": "", "changeTime": "2019-02-22T20:43:10.208Z", "changes": null, "disposition": "TRANSFORMED", "region": "", "resourceId": "", "resourceType": "", "tags": null}`,
+			ExpectedPath: "accountId",
+		},
+		{
+			Name:         "unknown-property",
+			Document:     `{"accountId": "", "arn": "", "changeTime": "2019-02-22T20:43:10.208Z", "changes": null, "disposition": "TRANSFORMED", "region": "", "resourceId": "", "resourceType": "", "tags": null, "foo": "bar"}`,
+			ExpectedPath: "foo",
+		},
+		{
+			Name:         "tag-value-type",
+			Document:     `{"accountId": "", "arn": "", "changeTime": "2019-02-22T20:43:10.208Z", "changes": null, "disposition": "TRANSFORMED", "region": "", "resourceId": "", "resourceType": "", "tags": {"foo": 1}}`,
+			ExpectedPath: "tags.foo",
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			var doc interface{}
+			require.Nil(t, json.Unmarshal([]byte(tt.Document), &doc))
+			err := s.validate("", doc)
+			require.NotNil(t, err)
+			assert.Equal(t, tt.ExpectedPath, err.(ErrSchemaViolation).Path)
+		})
+	}
+}
+
+func TestTransformerValidation(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "ec2.0.json"))
+	require.Nil(t, err)
+	var input Input
+	require.Nil(t, json.Unmarshal(data, &input))
+
+	// corrupt the capture time so that the output no longer conforms to the schema
+	var event map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(input.Message), &event))
+	event["configurationItem"].(map[string]interface{})["configurationItemCaptureTime"] = "not-a-time"
+	message, err := json.Marshal(event)
+	require.Nil(t, err)
+	input.Message = string(message)
+
+	for _, mode := range []string{"", ValidationOff, ValidationFlag} {
+		transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, Validation: mode}
+		output, err := transformer.Handle(context.Background(), input)
+		require.Nil(t, err, mode)
+		assert.Equal(t, "not-a-time", output.ChangeTime, mode)
+	}
+
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, Validation: ValidationReject}
+	_, err = transformer.Handle(context.Background(), input)
+	require.NotNil(t, err)
+	assert.IsType(t, ErrSchemaViolation{}, err)
+}
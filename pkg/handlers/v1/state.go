@@ -0,0 +1,201 @@
+package v1
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/logs"
+)
+
+// applyState replaces the changes of the output with the difference between the current
+// network identity of the resource and the last identity which was emitted for it, and
+// records the current identity. The first event seen for a resource keeps the changes
+// read from the AWS Config diff. An event which is not newer than the last one processed
+// for the resource is stale, and is either rejected or marked according to StaleEvents.
+func (t *Transformer) applyState(ctx context.Context, event awsConfigEvent, resourceTransformer ResourceTransformer, output Output) (Output, bool, error) {
+	if output.ARN == "" {
+		return output, false, nil
+	}
+	captureTime, _ := time.Parse(time.RFC3339Nano, event.ConfigurationItem.ConfigurationItemCaptureTime)
+	// the staleness of the event is decided in the same update as the state is replaced, so
+	// that concurrent events for the resource cannot both be applied against the same state
+	var last domain.ResourceState
+	var found, stale bool
+	var changes []Change
+	var transformErr error
+	err := t.State.Update(ctx, output.ARN, func(state domain.ResourceState, ok bool) (domain.ResourceState, error) {
+		last, found = state, ok
+		stale = found && isStale(last, event.ConfigurationItem.ConfigurationStateID, captureTime)
+		if stale {
+			return last, nil
+		}
+		current, err := currentState(event, resourceTransformer, output)
+		if err != nil {
+			transformErr = err
+			return domain.ResourceState{}, err
+		}
+		if found {
+			changes = stateChanges(last, current)
+		}
+		return current, nil
+	})
+	if transformErr != nil {
+		return Output{}, false, transformErr
+	}
+	if err != nil {
+		return Output{}, false, domain.ErrStateStore{Operation: "update", ARN: output.ARN, Err: err}
+	}
+	if !stale {
+		if found {
+			output.Changes = changes
+		}
+		return output, false, nil
+	}
+
+	action := "dropped"
+	if t.StaleEvents == StaleMark {
+		action = "marked"
+	}
+	t.LogFn(ctx).Info(logs.StaleEvent{
+		EventContext:             eventContext(event, output),
+		LastConfigurationStateID: last.ConfigurationStateID,
+		CaptureTime:              event.ConfigurationItem.ConfigurationItemCaptureTime,
+		LastCaptureTime:          formatCaptureTime(last.CaptureTime),
+		Action:                   action,
+	})
+	t.stat(ctx).Count("event.awsconfig.transformer.stale", 1)
+	if t.StaleEvents == StaleMark {
+		output.Stale = true
+		return output, false, nil
+	}
+	output.Changes = nil
+	output.FilterReason = "the event is older than the last event processed for the resource"
+	return output, true, nil
+}
+
+// currentState derives the network identity of the resource after the event. Every
+// transformer reads the full identity of the resource from the current configuration
+// when it is created, so the same is done for every event which is not a deletion.
+func currentState(event awsConfigEvent, resourceTransformer ResourceTransformer, output Output) (domain.ResourceState, error) {
+	captureTime, _ := time.Parse(time.RFC3339Nano, event.ConfigurationItem.ConfigurationItemCaptureTime)
+	state := domain.ResourceState{
+		ARN:                  output.ARN,
+		ResourceType:         output.ResourceType,
+		ConfigurationStateID: event.ConfigurationItem.ConfigurationStateID,
+		CaptureTime:          captureTime,
+	}
+	if event.ConfigurationItemDiff.ChangeType == delete {
+		state.Deleted = true
+		return state, nil
+	}
+	created, _, err := resourceTransformer.Create(event)
+	if err != nil {
+		return domain.ResourceState{}, err
+	}
+	for _, change := range created.Changes {
+		if change.ChangeType != added {
+			continue
+		}
+		state.PrivateIPAddresses = append(state.PrivateIPAddresses, change.PrivateIPAddresses...)
+		state.PublicIPAddresses = append(state.PublicIPAddresses, change.PublicIPAddresses...)
+		state.Hostnames = append(state.Hostnames, change.Hostnames...)
+		state.RelatedResources = append(state.RelatedResources, change.RelatedResources...)
+		state.Listeners = append(state.Listeners, listenerDiff(change.Listeners, state.Listeners)...)
+		state.NetworkInterfaces = append(state.NetworkInterfaces, change.NetworkInterfaces...)
+		if change.CIDRBlock != "" {
+			state.CIDRBlocks = append(state.CIDRBlocks, change.CIDRBlock)
+		}
+	}
+	state.PrivateIPAddresses = uniqueSorted(state.PrivateIPAddresses)
+	state.PublicIPAddresses = uniqueSorted(state.PublicIPAddresses)
+	state.Hostnames = uniqueSorted(state.Hostnames)
+	state.RelatedResources = uniqueSorted(state.RelatedResources)
+	state.CIDRBlocks = uniqueSorted(state.CIDRBlocks)
+	sortListeners(state.Listeners)
+	return state, nil
+}
+
+// isStale reports whether an event is not newer than the last event processed for the
+// resource. Events are ordered by configurationStateId, and by configurationItemCaptureTime
+// when either state ID is unknown. Events which cannot be ordered are not stale.
+func isStale(last domain.ResourceState, stateID int64, captureTime time.Time) bool {
+	if stateID != 0 && last.ConfigurationStateID != 0 {
+		return stateID <= last.ConfigurationStateID
+	}
+	if !captureTime.IsZero() && !last.CaptureTime.IsZero() {
+		return !captureTime.After(last.CaptureTime)
+	}
+	return false
+}
+
+func formatCaptureTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// stateChanges returns the changes between two network identities of a resource
+func stateChanges(last, current domain.ResourceState) []Change {
+	var changes []Change
+	changes = append(changes, identityChanges(added, current, last)...)
+	changes = append(changes, identityChanges(deleted, last, current)...)
+	return changes
+}
+
+// identityChanges returns the changes of the given type for the parts of the identity
+// which are not in the other identity. Change only holds one CIDR block, so any further
+// CIDR blocks are reported as changes of their own, and changed IP addresses are broken
+// down by network interface. The related resources are reported
+// when they are added or removed, such as the instances registered with a classic ELB,
+// and all of them are reported alongside changed addresses, such as the ELB an ENI is
+// attached to.
+func identityChanges(changeType string, identity, other domain.ResourceState) []Change {
+	change := Change{
+		ChangeType:         changeType,
+		PrivateIPAddresses: uniqueSorted(sliceDiff(identity.PrivateIPAddresses, other.PrivateIPAddresses)),
+		PublicIPAddresses:  uniqueSorted(sliceDiff(identity.PublicIPAddresses, other.PublicIPAddresses)),
+		Hostnames:          uniqueSorted(sliceDiff(identity.Hostnames, other.Hostnames)),
+		RelatedResources:   uniqueSorted(sliceDiff(identity.RelatedResources, other.RelatedResources)),
+		Listeners:          listenerDiff(identity.Listeners, other.Listeners),
+	}
+	cidrBlocks := sliceDiff(identity.CIDRBlocks, other.CIDRBlocks)
+	if len(cidrBlocks) > 0 {
+		change.CIDRBlock = cidrBlocks[0]
+		cidrBlocks = cidrBlocks[1:]
+	}
+	addressChanged := len(change.PrivateIPAddresses) > 0 || len(change.PublicIPAddresses) > 0 || len(change.Hostnames) > 0 || change.CIDRBlock != ""
+	if addressChanged {
+		change.RelatedResources = identity.RelatedResources
+		// the changed addresses are broken down by the network interfaces which hold them
+		change.NetworkInterfaces = append([]NetworkInterface(nil), identity.NetworkInterfaces...)
+		retainChangedInterfaces(&change)
+	}
+	var changes []Change
+	if addressChanged || len(change.RelatedResources) > 0 || len(change.Listeners) > 0 {
+		changes = append(changes, change)
+	}
+	for _, cidrBlock := range cidrBlocks {
+		changes = append(changes, Change{ChangeType: changeType, CIDRBlock: cidrBlock})
+	}
+	return changes
+}
+
+func uniqueSorted(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,359 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/store"
+	"github.com/asecurityteam/logevent"
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lifecycleARN = "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b"
+
+// lifecycleInterface returns the network interface of the instance with the given addresses
+func lifecycleInterface(private, public []string) NetworkInterface {
+	return NetworkInterface{
+		NetworkInterfaceID: "eni-05721fa8354d07b8c",
+		SubnetID:           "subnet-3d0b8c5a",
+		VpcID:              "vpc-b290fcd5",
+		PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+		PrivateIPAddresses: private,
+		PublicIPAddresses:  public,
+	}
+}
+
+func readInput(t *testing.T, name string) Input {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	require.Nil(t, err)
+	var input Input
+	require.Nil(t, json.Unmarshal(data, &input))
+	return input
+}
+
+func TestTransformWithStateOutOfOrder(t *testing.T) {
+	state := store.NewMemory()
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, State: state}
+	ctx := context.Background()
+
+	// the first event seen for a resource keeps the changes read from the diff
+	output, err := transformer.Handle(ctx, readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []Change{{
+		PrivateIPAddresses: []string{"172.31.30.79"},
+		PublicIPAddresses:  []string{"34.222.120.66"},
+		Hostnames:          []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
+		NetworkInterfaces:  []NetworkInterface{lifecycleInterface([]string{"172.31.30.79"}, []string{"34.222.120.66"})},
+		Exposure:           &Exposure{Classification: ExposurePublic, Reasons: []string{"34.222.120.66 is a public IP address", "172.31.30.79 is in the RFC 1918 range 172.16.0.0/12"}},
+		ChangeType:         added,
+	}}, output.Changes)
+
+	// the instance was stopped and started again, but the stop is delivered late. The
+	// changes derived from the state are broken down by network interface as well.
+	output, err = transformer.Handle(ctx, readInput(t, "ec2.2.json"))
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []Change{
+		{
+			PublicIPAddresses: []string{"34.219.72.29"},
+			Hostnames:         []string{"ec2-34-219-72-29.us-west-2.compute.amazonaws.com"},
+			NetworkInterfaces: []NetworkInterface{lifecycleInterface(nil, []string{"34.219.72.29"})},
+			Exposure:          &Exposure{Classification: ExposurePublic, Reasons: []string{"34.219.72.29 is a public IP address"}},
+			ChangeType:        added,
+		},
+		{
+			PublicIPAddresses: []string{"34.222.120.66"},
+			Hostnames:         []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
+			NetworkInterfaces: []NetworkInterface{lifecycleInterface(nil, []string{"34.222.120.66"})},
+			Exposure:          &Exposure{Classification: ExposurePublic, Reasons: []string{"34.222.120.66 is a public IP address"}},
+			ChangeType:        deleted,
+		},
+	}, output.Changes)
+
+	output, err = transformer.Handle(ctx, readInput(t, "ec2.1.json"))
+	require.Nil(t, err)
+	assert.Equal(t, lifecycleARN, output.ARN)
+	assert.Empty(t, output.Changes)
+
+	last, found, err := state.Get(ctx, lifecycleARN)
+	require.Nil(t, err)
+	require.True(t, found)
+	assert.Equal(t, int64(1550869338758), last.ConfigurationStateID)
+	assert.Equal(t, []string{"34.219.72.29"}, last.PublicIPAddresses)
+
+	// redelivery of the last event is stale as well
+	output, err = transformer.Handle(ctx, readInput(t, "ec2.2.json"))
+	require.Nil(t, err)
+	assert.Empty(t, output.Changes)
+}
+
+func TestTransformWithStateDelete(t *testing.T) {
+	state := store.NewMemory()
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, State: state}
+	ctx := context.Background()
+
+	for _, name := range []string{"ec2.0.json", "ec2.1.json", "ec2.2.json", "ec2.3.json"} {
+		_, err := transformer.Handle(ctx, readInput(t, name))
+		require.Nil(t, err, name)
+	}
+	output, err := transformer.Handle(ctx, readInput(t, "ec2.4.json"))
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []Change{{
+		PrivateIPAddresses: []string{"172.31.30.79"},
+		NetworkInterfaces:  []NetworkInterface{lifecycleInterface([]string{"172.31.30.79"}, nil)},
+		Exposure:           &Exposure{Classification: ExposurePrivate, Reasons: []string{"172.31.30.79 is in the RFC 1918 range 172.16.0.0/12"}},
+		ChangeType:         deleted,
+	}}, output.Changes)
+
+	last, found, err := state.Get(ctx, lifecycleARN)
+	require.Nil(t, err)
+	require.True(t, found)
+	assert.True(t, last.Deleted)
+
+	// an update delivered after the deletion does not resurrect the instance
+	output, err = transformer.Handle(ctx, readInput(t, "ec2.3.json"))
+	require.Nil(t, err)
+	assert.Empty(t, output.Changes)
+}
+
+func TestStateChanges(t *testing.T) {
+	last := domain.ResourceState{
+		PrivateIPAddresses: []string{"10.0.0.1", "10.0.0.2"},
+		Hostnames:          []string{"a.example.com"},
+		CIDRBlocks:         []string{"10.0.0.0/24"},
+		RelatedResources:   []string{"elb-1"},
+	}
+	current := domain.ResourceState{
+		PrivateIPAddresses: []string{"10.0.0.2", "10.0.0.3"},
+		Hostnames:          []string{"a.example.com"},
+		CIDRBlocks:         []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"},
+		RelatedResources:   []string{"elb-2"},
+	}
+	assert.ElementsMatch(t, []Change{
+		{
+			PrivateIPAddresses: []string{"10.0.0.3"},
+			CIDRBlock:          "10.0.1.0/24",
+			RelatedResources:   []string{"elb-2"},
+			ChangeType:         added,
+		},
+		{CIDRBlock: "10.0.2.0/24", ChangeType: added},
+		{
+			PrivateIPAddresses: []string{"10.0.0.1"},
+			RelatedResources:   []string{"elb-1"},
+			ChangeType:         deleted,
+		},
+	}, stateChanges(last, current))
+	assert.Empty(t, stateChanges(current, current))
+}
+
+type failingStateStore struct{}
+
+func (failingStateStore) Get(context.Context, string) (domain.ResourceState, bool, error) {
+	return domain.ResourceState{}, false, errors.New("unavailable")
+}
+
+func (failingStateStore) Put(context.Context, domain.ResourceState) error {
+	return errors.New("unavailable")
+}
+
+func (failingStateStore) Update(context.Context, string, func(domain.ResourceState, bool) (domain.ResourceState, error)) error {
+	return errors.New("unavailable")
+}
+
+func TestTransformWithStateStoreError(t *testing.T) {
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, State: failingStateStore{}}
+	_, err := transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.NotNil(t, err)
+	assert.Equal(t, domain.ErrStateStore{Operation: "update", ARN: lifecycleARN, Err: errors.New("unavailable")}, err)
+}
+
+// recordingStat records the counts and timings emitted by the transformer, and the tags of
+// the last emission of each metric
+type recordingStat struct {
+	mu      sync.Mutex
+	counts  map[string]float64
+	timings map[string]time.Duration
+	tags    map[string][]string
+}
+
+func (s *recordingStat) Gauge(string, float64, ...string)     {}
+func (s *recordingStat) Histogram(string, float64, ...string) {}
+func (s *recordingStat) AddTags(...string)                    {}
+func (s *recordingStat) GetTags() []string                    { return nil }
+func (s *recordingStat) Count(stat string, count float64, tags ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = map[string]float64{}
+	}
+	s.counts[stat] += count
+	s.recordTags(stat, tags)
+}
+func (s *recordingStat) Timing(stat string, duration time.Duration, tags ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timings == nil {
+		s.timings = map[string]time.Duration{}
+	}
+	s.timings[stat] = duration
+	s.recordTags(stat, tags)
+}
+
+func (s *recordingStat) recordTags(stat string, tags []string) {
+	if s.tags == nil {
+		s.tags = map[string][]string{}
+	}
+	s.tags[stat] = tags
+}
+
+func TestTransformWithStateStaleEvents(t *testing.T) {
+	for _, mode := range []string{StaleDrop, StaleMark} {
+		mode := mode
+		t.Run(mode, func(t *testing.T) {
+			var logs bytes.Buffer
+			stat := &recordingStat{}
+			transformer := &Transformer{
+				LogFn:       func(context.Context) domain.Logger { return logevent.New(logevent.Config{Output: &logs}) },
+				StatFn:      func(context.Context) domain.Stat { return stat },
+				State:       store.NewMemory(),
+				StaleEvents: mode,
+			}
+			ctx := context.Background()
+			for _, name := range []string{"ec2.0.json", "ec2.2.json"} {
+				_, err := transformer.Handle(ctx, readInput(t, name))
+				require.Nil(t, err, name)
+			}
+			assert.NotContains(t, logs.String(), "stale-event")
+
+			output, err := transformer.Handle(ctx, readInput(t, "ec2.1.json"))
+			require.Nil(t, err)
+			if mode == StaleMark {
+				assert.True(t, output.Stale)
+				// the changes are read from the AWS Config diff
+				assert.ElementsMatch(t, []Change{{
+					PublicIPAddresses:  []string{"34.222.120.66"},
+					PrivateIPAddresses: []string{},
+					Hostnames:          []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
+					NetworkInterfaces: []NetworkInterface{{
+						NetworkInterfaceID: "eni-05721fa8354d07b8c",
+						SubnetID:           "subnet-3d0b8c5a",
+						VpcID:              "vpc-b290fcd5",
+						PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+						PublicIPAddresses:  []string{"34.222.120.66"},
+					}},
+					Exposure:   &Exposure{Classification: ExposurePublic, Reasons: []string{"34.222.120.66 is a public IP address"}},
+					ChangeType: deleted,
+				}}, output.Changes)
+				assert.Contains(t, logs.String(), `"action":"marked"`)
+			} else {
+				assert.False(t, output.Stale)
+				assert.Empty(t, output.Changes)
+				assert.Equal(t, DispositionFiltered, output.Disposition)
+				assert.NotEmpty(t, output.FilterReason)
+				assert.Contains(t, logs.String(), `"action":"dropped"`)
+			}
+			assert.Contains(t, logs.String(), `"message":"stale-event"`)
+			assert.Contains(t, logs.String(), `"last_configuration_state_id":1550869338758`)
+			assert.Equal(t, float64(1), stat.counts["event.awsconfig.transformer.stale"])
+
+			// the stale event does not replace the last known state
+			last, _, err := transformer.State.Get(ctx, lifecycleARN)
+			require.Nil(t, err)
+			assert.Equal(t, int64(1550869338758), last.ConfigurationStateID)
+		})
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	earlier := time.Date(2019, 2, 22, 20, 48, 32, 0, time.UTC)
+	later := earlier.Add(time.Minute)
+	tc := []struct {
+		Name        string
+		Last        domain.ResourceState
+		StateID     int64
+		CaptureTime time.Time
+		Expected    bool
+	}{
+		{Name: "newer-state-id", Last: domain.ResourceState{ConfigurationStateID: 1, CaptureTime: later}, StateID: 2, CaptureTime: earlier, Expected: false},
+		{Name: "older-state-id", Last: domain.ResourceState{ConfigurationStateID: 2, CaptureTime: earlier}, StateID: 1, CaptureTime: later, Expected: true},
+		{Name: "same-state-id", Last: domain.ResourceState{ConfigurationStateID: 2}, StateID: 2, Expected: true},
+		{Name: "newer-capture-time", Last: domain.ResourceState{CaptureTime: earlier}, StateID: 1, CaptureTime: later, Expected: false},
+		{Name: "older-capture-time", Last: domain.ResourceState{ConfigurationStateID: 2, CaptureTime: later}, CaptureTime: earlier, Expected: true},
+		{Name: "same-capture-time", Last: domain.ResourceState{CaptureTime: earlier}, CaptureTime: earlier, Expected: true},
+		{Name: "unordered", Last: domain.ResourceState{ConfigurationStateID: 2}, CaptureTime: earlier, Expected: false},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, isStale(tt.Last, tt.StateID, tt.CaptureTime))
+		})
+	}
+}
+
+// elbInstanceInput returns the update of the classic ELB which registers an instance
+func elbInstanceInput(t *testing.T) Input {
+	input := readInput(t, "elb.update.json")
+	var event awsConfigEvent
+	require.Nil(t, json.Unmarshal([]byte(input.Message), &event))
+	var config map[string]interface{}
+	require.Nil(t, json.Unmarshal(event.ConfigurationItem.Configuration, &config))
+	config["instances"] = []map[string]string{{"instanceId": "i-0123456789abcdef0"}}
+	configuration, err := json.Marshal(config)
+	require.Nil(t, err)
+	event.ConfigurationItem.Configuration = configuration
+	event.ConfigurationItemDiff.ChangedProperties = map[string]json.RawMessage{
+		"Configuration.Instances.0": json.RawMessage(`{"previousValue":null,"updatedValue":{"instanceId":"i-0123456789abcdef0"},"changeType":"CREATE"}`),
+	}
+	message, err := json.Marshal(event)
+	require.Nil(t, err)
+	input.Message = string(message)
+	return input
+}
+
+func TestTransformWithStateELBInstances(t *testing.T) {
+	state := store.NewMemory()
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, State: state}
+	ctx := context.Background()
+
+	_, err := transformer.Handle(ctx, readInput(t, "elb.create.json"))
+	require.Nil(t, err)
+	output, err := transformer.Handle(ctx, elbInstanceInput(t))
+	require.Nil(t, err)
+	require.Len(t, output.Changes, 1)
+	assert.Equal(t, added, output.Changes[0].ChangeType)
+	assert.Equal(t, []string{"arn:aws:ec2:us-west-2:123456789012:instance/i-0123456789abcdef0"}, output.Changes[0].RelatedResources)
+	assert.Empty(t, output.Changes[0].Hostnames)
+
+	last, found, err := state.Get(ctx, "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/config-test-elb")
+	require.Nil(t, err)
+	require.True(t, found)
+	assert.Equal(t, []Listener{{Protocol: "HTTP", Port: 80, InstanceProtocol: "HTTP", InstancePort: 80}}, last.Listeners)
+}
+
+func TestStateChangesListeners(t *testing.T) {
+	http := Listener{Protocol: "HTTP", Port: 80}
+	https := Listener{Protocol: "HTTPS", Port: 443}
+	last := domain.ResourceState{
+		Hostnames:        []string{"elb.example.com"},
+		Listeners:        []Listener{http},
+		RelatedResources: []string{"instance-1"},
+	}
+	current := domain.ResourceState{
+		Hostnames:        []string{"elb.example.com"},
+		Listeners:        []Listener{https},
+		RelatedResources: []string{"instance-1", "instance-2"},
+	}
+	assert.ElementsMatch(t, []Change{
+		{Listeners: []Listener{https}, RelatedResources: []string{"instance-2"}, ChangeType: added},
+		{Listeners: []Listener{http}, ChangeType: deleted},
+	}, stateChanges(last, current))
+}
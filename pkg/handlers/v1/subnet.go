@@ -1,11 +1,5 @@
 package v1
 
-import (
-	"encoding/json"
-	"errors"
-	"fmt"
-)
-
 type subnetConfiguration struct {
 	CIDRBlock string `json:"cidrBlock"`
 	VPCID     string `json:"vpcId"`
@@ -26,7 +20,7 @@ func (t subnetTransformer) Create(event awsConfigEvent) (Output, bool, error) {
 	}
 
 	var config subnetConfiguration
-	if err := json.Unmarshal(event.ConfigurationItem.Configuration, &config); err != nil {
+	if err := unmarshalConfiguration(event.ConfigurationItem, &config); err != nil {
 		return Output{}, false, err
 	}
 
@@ -51,23 +45,17 @@ func (t subnetTransformer) Delete(event awsConfigEvent) (Output, bool, error) {
 		return Output{}, false, err
 	}
 
-	changeProps := event.ConfigurationItemDiff.ChangedProperties
-
-	configDiffRaw, ok := changeProps["Configuration"]
-	if !ok {
-		return Output{}, false, errors.New("invalid configuration diff")
-	}
-
 	var configDiff subnetConfigurationDiff
-
-	if err := json.Unmarshal(configDiffRaw, &configDiff); err != nil {
+	if err := requireChangedProperty(event, "Configuration", &configDiff); err != nil {
 		return Output{}, false, err
 	}
 
+	if configDiff.PreviousValue == nil {
+		return Output{}, false, errMissingDiffValue(event, "Configuration", delete)
+	}
 	change := extractSubnetInfo(configDiff.PreviousValue)
 	change.ChangeType = deleted
 	output.Changes = append(output.Changes, change)
-	fmt.Println(output)
 	return output, false, nil
 }
 
@@ -69,7 +69,7 @@ func Test_subnetTransformer_Create(t *testing.T) {
 			wantOutput:  Output{},
 			wantReject:  false,
 			wantErr:     true,
-			expectedErr: "unexpected end of JSON input",
+			expectedErr: "malformed property Configuration for AWS::EC2::Subnet: unexpected end of JSON input",
 		},
 		{
 			name: "missing account ID (first field checked)",
@@ -231,7 +231,7 @@ func Test_subnetTransformer_Delete(t *testing.T) {
 			wantOutput:  Output{},
 			wantReject:  false,
 			wantErr:     true,
-			expectedErr: "invalid configuration diff",
+			expectedErr: "no field ChangedProperties.Configuration was provided for AWS::EC2::Subnet",
 		},
 		{
 			name: "malformed - invalid config diff",
@@ -247,7 +247,7 @@ func Test_subnetTransformer_Delete(t *testing.T) {
 			wantOutput:  Output{},
 			wantReject:  false,
 			wantErr:     true,
-			expectedErr: "unexpected end of JSON input",
+			expectedErr: "malformed property ChangedProperties.Configuration for AWS::EC2::Subnet: unexpected end of JSON input",
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,40 @@
+package v1
+
+// AllResourceTypes matches every resource type in TagChangeTypes
+const AllResourceTypes = "*"
+
+// tagChangeTransformer is the fallback for resource types without network information.
+// It only describes the resource, and the tag changes are added by the Transformer.
+type tagChangeTransformer struct{}
+
+func (t tagChangeTransformer) Create(event awsConfigEvent) (Output, bool, error) {
+	output, err := getBaseOutput(event.ConfigurationItem)
+	if err != nil {
+		return Output{}, false, err
+	}
+	return output, false, nil
+}
+
+func (t tagChangeTransformer) Update(event awsConfigEvent) (Output, bool, error) {
+	return t.Create(event)
+}
+
+func (t tagChangeTransformer) Delete(event awsConfigEvent) (Output, bool, error) {
+	return t.Create(event)
+}
+
+// emitsTagChanges reports whether tag changes are emitted for a resource type which is
+// not otherwise supported
+func (t *Transformer) emitsTagChanges(resourceType string) bool {
+	for _, excluded := range t.TagChangeExcludedTypes {
+		if excluded == resourceType || excluded == AllResourceTypes {
+			return false
+		}
+	}
+	for _, included := range t.TagChangeTypes {
+		if included == resourceType || included == AllResourceTypes {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bucketTagInput(t *testing.T) Input {
+	event := awsConfigEvent{
+		ConfigurationItemDiff: configurationItemDiff{
+			ChangeType: update,
+			ChangedProperties: map[string]json.RawMessage{
+				"Configuration.TagSet.0": json.RawMessage(`{"previousValue":null,"updatedValue":{"key":"key1","value":"1"},"changeType":"CREATE"}`),
+			},
+		},
+		ConfigurationItem: configurationItem{
+			Tags:                         map[string]string{"key1": "1"},
+			ConfigurationItemCaptureTime: "2019-03-27T19:12:28.624Z",
+			AWSAccountID:                 "123456789012",
+			ResourceType:                 "AWS::S3::Bucket",
+			ResourceID:                   "config-test-bucket",
+			ResourceName:                 "config-test-bucket",
+			ARN:                          "arn:aws:s3:::config-test-bucket",
+			AWSRegion:                    "us-west-2",
+		},
+		MessageType: configurationItemChangeNotification,
+	}
+	raw, err := json.Marshal(event)
+	require.Nil(t, err)
+	return Input{Message: string(raw)}
+}
+
+func TestTransformTagChangesOnly(t *testing.T) {
+	transformer := &Transformer{
+		LogFn:          logFn,
+		StatFn:         runhttp.StatFromContext,
+		TagChangeTypes: []string{AllResourceTypes},
+	}
+	output, err := transformer.Handle(context.Background(), bucketTagInput(t))
+	require.Nil(t, err)
+	assert.Equal(t, Output{
+		ChangeTime:   "2019-03-27T19:12:28.624Z",
+		ResourceType: "AWS::S3::Bucket",
+		AccountID:    "123456789012",
+		Region:       "us-west-2",
+		ARN:          "arn:aws:s3:::config-test-bucket",
+		ResourceID:   "config-test-bucket",
+		ResourceName: "config-test-bucket",
+		Tags:         map[string]string{"key1": "1"},
+		Changes: []Change{{
+			TagChanges: []TagChange{{UpdatedValue: &Tag{Key: "key1", Value: "1"}}},
+			Exposure:   &Exposure{Classification: ExposureUnknown, Reasons: []string{"the change has no IP address, CIDR block or load balancer scheme"}},
+			ChangeType: added,
+		}},
+		Disposition: DispositionTransformed,
+	}, output)
+
+	// resource types which are not allowed, or are excluded, are unsupported
+	for _, transformer := range []*Transformer{
+		{LogFn: logFn, StatFn: runhttp.StatFromContext},
+		{LogFn: logFn, StatFn: runhttp.StatFromContext, TagChangeTypes: []string{"AWS::Lambda::Function"}},
+		{LogFn: logFn, StatFn: runhttp.StatFromContext, TagChangeTypes: []string{AllResourceTypes}, TagChangeExcludedTypes: []string{"AWS::S3::Bucket"}},
+	} {
+		output, err := transformer.Handle(context.Background(), bucketTagInput(t))
+		require.Nil(t, err)
+		assert.Equal(t, Output{Disposition: DispositionUnsupported}, output)
+	}
+}
+
+func TestTransformTagChangesOnDelete(t *testing.T) {
+	transformer := &Transformer{
+		LogFn:          logFn,
+		StatFn:         runhttp.StatFromContext,
+		TagChangeTypes: []string{AllResourceTypes},
+	}
+	raw, err := json.Marshal(awsConfigEvent{
+		ConfigurationItemDiff: configurationItemDiff{
+			ChangeType: delete,
+			ChangedProperties: map[string]json.RawMessage{
+				"Configuration.TagSet.0": json.RawMessage(`{"previousValue":{"key":"key1","value":"1"},"updatedValue":null,"changeType":"DELETE"}`),
+			},
+		},
+		ConfigurationItem: configurationItem{
+			ConfigurationItemCaptureTime: "2019-03-27T19:12:28.624Z",
+			AWSAccountID:                 "123456789012",
+			ResourceType:                 "AWS::Lambda::Function",
+			ResourceID:                   "config-test-function",
+			ARN:                          "arn:aws:lambda:us-west-2:123456789012:function:config-test-function",
+			AWSRegion:                    "us-west-2",
+		},
+		MessageType: configurationItemChangeNotification,
+	})
+	require.Nil(t, err)
+	output, err := transformer.Handle(context.Background(), Input{Message: string(raw)})
+	require.Nil(t, err)
+	// the tags of a deleted resource are reported as deleted
+	require.Len(t, output.Changes, 1)
+	assert.Equal(t, deleted, output.Changes[0].ChangeType)
+	assert.Equal(t, []TagChange{{PreviousValue: &Tag{Key: "key1", Value: "1"}}}, output.Changes[0].TagChanges)
+}
+
+func TestEmitsTagChanges(t *testing.T) {
+	transformer := &Transformer{
+		TagChangeTypes:         []string{"AWS::S3::Bucket", "AWS::Lambda::Function"},
+		TagChangeExcludedTypes: []string{"AWS::Lambda::Function"},
+	}
+	assert.True(t, transformer.emitsTagChanges("AWS::S3::Bucket"))
+	assert.False(t, transformer.emitsTagChanges("AWS::Lambda::Function"))
+	assert.False(t, transformer.emitsTagChanges("AWS::IAM::Role"))
+
+	transformer.TagChangeTypes = []string{AllResourceTypes}
+	assert.True(t, transformer.emitsTagChanges("AWS::IAM::Role"))
+	transformer.TagChangeExcludedTypes = []string{AllResourceTypes}
+	assert.False(t, transformer.emitsTagChanges("AWS::S3::Bucket"))
+}
@@ -0,0 +1,153 @@
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// owner fields which can be extracted from tags
+const (
+	ownerService      = "service"
+	ownerBusinessUnit = "businessUnit"
+	ownerTeam         = "team"
+	ownerContact      = "contact"
+)
+
+// TagNormaliser maps the tag keys of outputs to canonical keys, normalises tag values and
+// extracts the owner of the resource from its tags
+type TagNormaliser struct {
+	// Aliases maps folded tag keys to canonical keys. See foldTagKey.
+	Aliases map[string]string
+
+	// OwnerKeys maps owner fields, e.g. "service", to the canonical tag key they are read from
+	OwnerKeys map[string]string
+}
+
+// NewTagNormaliser builds a TagNormaliser from alias=canonical pairs and field=key pairs
+func NewTagNormaliser(aliases []string, ownerTags []string) (*TagNormaliser, error) {
+	n := &TagNormaliser{Aliases: map[string]string{}, OwnerKeys: map[string]string{}}
+	for _, pair := range aliases {
+		alias, canonical, err := splitPair(pair)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag alias %s: %s", pair, err.Error())
+		}
+		n.Aliases[foldTagKey(alias)] = canonical
+		n.Aliases[foldTagKey(canonical)] = canonical
+	}
+	for _, pair := range ownerTags {
+		field, key, err := splitPair(pair)
+		if err != nil {
+			return nil, fmt.Errorf("invalid owner tag %s: %s", pair, err.Error())
+		}
+		switch field {
+		case ownerService, ownerBusinessUnit, ownerTeam, ownerContact:
+		default:
+			return nil, fmt.Errorf("unknown owner field %s", field)
+		}
+		n.OwnerKeys[field] = n.canonicalKey(key)
+	}
+	return n, nil
+}
+
+func splitPair(pair string) (string, string, error) {
+	parts := strings.SplitN(pair, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return "", "", fmt.Errorf("expected a pair of the form a=b")
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// foldTagKey lower cases the key and drops everything but letters and digits, so that
+// "ServiceName", "service_name" and "Service-Name" are aliases of each other
+func foldTagKey(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// canonicalKey returns the canonical key of an alias, or the trimmed key if it is not an alias
+func (n *TagNormaliser) canonicalKey(key string) string {
+	if canonical, ok := n.Aliases[foldTagKey(key)]; ok {
+		return canonical
+	}
+	return strings.TrimSpace(key)
+}
+
+// normaliseTagValue trims the value and collapses runs of whitespace into single spaces
+func normaliseTagValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// normalise rewrites the tags and tag changes of the output and sets its owner
+func (n *TagNormaliser) normalise(output *Output) {
+	if output.Tags != nil {
+		output.Tags = n.normaliseTags(output.Tags)
+	}
+	for i := range output.Changes {
+		n.normaliseTagChanges(output.Changes[i].TagChanges)
+	}
+	output.Owner = n.owner(output.Tags)
+}
+
+// normaliseTagChanges rewrites the keys and values of the tag changes in place
+func (n *TagNormaliser) normaliseTagChanges(tagChanges []TagChange) {
+	for i, tc := range tagChanges {
+		tagChanges[i] = TagChange{
+			UpdatedValue:  n.normaliseTag(tc.UpdatedValue),
+			PreviousValue: n.normaliseTag(tc.PreviousValue),
+		}
+	}
+}
+
+// normaliseTags returns the tags with canonical keys and normalised values. When several keys
+// are aliases of the same canonical key, the tag with the canonical key itself wins, and
+// otherwise the tag with the first key in sort order.
+func (n *TagNormaliser) normaliseTags(tags map[string]string) map[string]string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	normalised := make(map[string]string, len(tags))
+	for _, key := range keys {
+		canonical := n.canonicalKey(key)
+		if _, ok := normalised[canonical]; ok && key != canonical {
+			continue
+		}
+		normalised[canonical] = normaliseTagValue(tags[key])
+	}
+	return normalised
+}
+
+func (n *TagNormaliser) normaliseTag(tag *Tag) *Tag {
+	if tag == nil {
+		return nil
+	}
+	return &Tag{Key: n.canonicalKey(tag.Key), Value: normaliseTagValue(tag.Value)}
+}
+
+// owner reads the owner fields from normalised tags, and returns nil if none of them is set
+func (n *TagNormaliser) owner(tags map[string]string) *Owner {
+	field := func(name string) string {
+		if key, ok := n.OwnerKeys[name]; ok {
+			return tags[key]
+		}
+		return ""
+	}
+	owner := Owner{
+		Service:      field(ownerService),
+		BusinessUnit: field(ownerBusinessUnit),
+		Team:         field(ownerTeam),
+		Contact:      field(ownerContact),
+	}
+	if owner == (Owner{}) {
+		return nil
+	}
+	return &owner
+}
@@ -0,0 +1,96 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldTagKey(t *testing.T) {
+	for _, key := range []string{"ServiceName", "service_name", "Service-Name", " service name "} {
+		assert.Equal(t, "servicename", foldTagKey(key), key)
+	}
+}
+
+func TestTagNormaliser(t *testing.T) {
+	normaliser, err := NewTagNormaliser(
+		[]string{"ServiceName=service_name", "service=service_name", "BU=business_unit"},
+		[]string{"service=service_name", "businessUnit=BusinessUnit", "contact=owner"},
+	)
+	require.Nil(t, err)
+
+	output := Output{
+		Tags: map[string]string{
+			"Service":       "ignored",
+			"SERVICE-NAME":  "  foo-bar ",
+			"bu":            "CISO  Security",
+			"Environment ":  "prod",
+			"unrelated_key": "value",
+		},
+		Changes: []Change{{
+			TagChanges: []TagChange{
+				{UpdatedValue: &Tag{Key: "ServiceName", Value: "foo-bar "}, PreviousValue: &Tag{Key: "serviceName", Value: "foo"}},
+				{UpdatedValue: nil, PreviousValue: &Tag{Key: "BU", Value: "CISO"}},
+			},
+			ChangeType: added,
+		}},
+	}
+	normaliser.normalise(&output)
+
+	assert.Equal(t, map[string]string{
+		"service_name":  "foo-bar",
+		"business_unit": "CISO Security",
+		"Environment":   "prod",
+		"unrelated_key": "value",
+	}, output.Tags)
+	assert.Equal(t, []TagChange{
+		{UpdatedValue: &Tag{Key: "service_name", Value: "foo-bar"}, PreviousValue: &Tag{Key: "service_name", Value: "foo"}},
+		{UpdatedValue: nil, PreviousValue: &Tag{Key: "business_unit", Value: "CISO"}},
+	}, output.Changes[0].TagChanges)
+	assert.Equal(t, &Owner{Service: "foo-bar", BusinessUnit: "CISO Security"}, output.Owner)
+
+	// the tag with the canonical key wins over its aliases
+	output = Output{Tags: map[string]string{"ServiceName": "alias", "service_name": "canonical"}}
+	normaliser.normalise(&output)
+	assert.Equal(t, map[string]string{"service_name": "canonical"}, output.Tags)
+
+	// outputs without any owner tag have no owner
+	output = Output{Tags: map[string]string{"key1": "1"}}
+	normaliser.normalise(&output)
+	assert.Nil(t, output.Owner)
+}
+
+func TestNewTagNormaliserErrors(t *testing.T) {
+	_, err := NewTagNormaliser([]string{"service_name"}, nil)
+	assert.Error(t, err)
+	_, err = NewTagNormaliser([]string{"=service_name"}, nil)
+	assert.Error(t, err)
+	_, err = NewTagNormaliser(nil, []string{"manager=manager"})
+	assert.Error(t, err)
+}
+
+func TestTransformNormalisesTags(t *testing.T) {
+	normaliser, err := NewTagNormaliser(
+		[]string{"Service=service_name", "BusinessUnit=business_unit"},
+		[]string{"service=service", "businessUnit=business_unit"},
+	)
+	require.Nil(t, err)
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext, Tags: normaliser}
+
+	output, err := transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"business_unit": "CISO-Security",
+		"service_name":  "foo-bar",
+	}, output.Tags)
+	assert.Equal(t, &Owner{Service: "foo-bar", BusinessUnit: "CISO-Security"}, output.Owner)
+
+	output, err = transformer.Handle(context.Background(), readInput(t, "elbv2.update.json"))
+	require.Nil(t, err)
+	assert.Nil(t, output.Owner)
+	require.Len(t, output.Changes, 1)
+	assert.ElementsMatch(t, addedTags, output.Changes[0].TagChanges)
+}
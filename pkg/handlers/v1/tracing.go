@@ -0,0 +1,169 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// TracingNone disables the export of spans
+	TracingNone = "NONE"
+	// TracingStdout writes spans to standard output as JSON
+	TracingStdout = "STDOUT"
+	// TracingFile appends spans to a file as JSON
+	TracingFile = "FILE"
+	// TracingOTLP sends spans to an OTLP/HTTP endpoint, such as an OpenTelemetry collector
+	TracingOTLP = "OTLP"
+)
+
+// tracerName is the instrumentation name of the spans of the transformer
+const tracerName = "github.com/asecurityteam/awsconfig-transformerd/pkg/handlers/v1"
+
+// span attributes
+const (
+	attributeResourceType = attribute.Key("awsconfig.resource_type")
+	attributeARN          = attribute.Key("awsconfig.arn")
+	attributeChangeType   = attribute.Key("awsconfig.change_type")
+	attributeOutcome      = attribute.Key("awsconfig.outcome")
+	attributeTagChanges   = attribute.Key("awsconfig.tag_changes")
+)
+
+// TracingConfig is the configuration of the export of spans.
+type TracingConfig struct {
+	Exporter    string `description:"Exporter of the spans of every event. One of NONE, STDOUT, FILE or OTLP."`
+	Path        string `description:"Path of the file the FILE exporter appends spans to."`
+	Endpoint    string `description:"URL the OTLP exporter sends spans to over HTTP."`
+	ServiceName string `description:"Name of the service in the resource of every span."`
+}
+
+// Name of the configuration root.
+func (*TracingConfig) Name() string {
+	return "tracing"
+}
+
+// Description returns the help information for the configuration root.
+func (*TracingConfig) Description() string {
+	return "OpenTelemetry tracing settings."
+}
+
+// NewTracerProvider builds a tracer provider for the configured exporter, or returns nil
+// if the export of spans is disabled. The JSON exporters write spans as they end, while the
+// OTLP exporter sends them in batches. The returned function flushes the spans and closes the
+// file of the FILE exporter, and is called once the provider is no longer used.
+func NewTracerProvider(ctx context.Context, conf *TracingConfig) (*sdktrace.TracerProvider, func(context.Context) error, error) {
+	var w io.Writer
+	closeWriter := func() error { return nil }
+	switch strings.ToUpper(conf.Exporter) {
+	case "", TracingNone:
+		return nil, func(context.Context) error { return nil }, nil
+	case TracingStdout:
+		w = os.Stdout
+	case TracingFile:
+		f, err := os.OpenFile(conf.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		w = f
+		closeWriter = f.Close
+	case TracingOTLP:
+		// the exporter keeps its default endpoint when the URL does not parse, so it is checked here
+		u, err := url.Parse(conf.Endpoint)
+		if err != nil || u.Host == "" {
+			return nil, nil, fmt.Errorf("invalid tracing endpoint %q", conf.Endpoint)
+		}
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(conf.Endpoint))
+		if err != nil {
+			return nil, nil, err
+		}
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(tracingResource(conf)),
+		)
+		return provider, provider.Shutdown, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter %s", conf.Exporter)
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		_ = closeWriter()
+		return nil, nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithResource(tracingResource(conf)),
+	)
+	shutdown := func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeErr := closeWriter(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return provider, shutdown, nil
+}
+
+// tracingResource names the service in the resource of every span
+func tracingResource(conf *TracingConfig) *resource.Resource {
+	return resource.NewSchemaless(attribute.String("service.name", conf.ServiceName))
+}
+
+// TraceContext extracts the W3C trace context of incoming requests into their context, so
+// that the spans of the handlers continue the trace of the caller
+func TraceContext(next http.Handler) http.Handler {
+	propagator := propagation.TraceContext{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tracer returns the tracer of the transformer, which drops every span if none is set
+func (t *Transformer) tracer() trace.Tracer {
+	if t.Tracer == nil {
+		return noop.Tracer{}
+	}
+	return t.Tracer
+}
+
+// eventAttributes identifies the event in spans
+func eventAttributes(event awsConfigEvent) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attributeResourceType.String(event.ConfigurationItem.ResourceType),
+		attributeARN.String(event.ConfigurationItem.ARN),
+		attributeChangeType.String(event.ConfigurationItemDiff.ChangeType),
+	}
+}
+
+// outputAttributes records the outcome of the event in spans, and replaces the ARN of the
+// configuration item with the ARN of the output, which is recovered for deleted resources
+func outputAttributes(output Output, err error) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attributeOutcome.String(eventOutcome(output, err))}
+	if output.ARN != "" {
+		attributes = append(attributes, attributeARN.String(output.ARN))
+	}
+	return attributes
+}
+
+// endSpan records the error, if any, on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
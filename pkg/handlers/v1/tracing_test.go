@@ -0,0 +1,177 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/asecurityteam/runhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordingTransformer returns a transformer whose spans are recorded
+func recordingTransformer() (*Transformer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return &Transformer{
+		LogFn:  logFn,
+		StatFn: runhttp.StatFromContext,
+		Tracer: provider.Tracer(tracerName),
+	}, recorder
+}
+
+// spansByName indexes the ended spans by name
+func spansByName(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTransformSpans(t *testing.T) {
+	transformer, recorder := recordingTransformer()
+	output, err := transformer.Handle(context.Background(), readInput(t, "elbv2.update.json"))
+	require.Nil(t, err)
+
+	spans := spansByName(recorder)
+	require.Len(t, spans, 4)
+	root := spans["transformer.handle"]
+	require.NotNil(t, root)
+	for _, name := range []string{"transformer.parse", "transformer.resource", "transformer.tags"} {
+		span := spans[name]
+		require.NotNil(t, span, name)
+		assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID(), name)
+		assert.Equal(t, "AWS::ElasticLoadBalancingV2::LoadBalancer", spanAttribute(span, attributeResourceType).AsString(), name)
+		assert.Equal(t, output.ARN, spanAttribute(span, attributeARN).AsString(), name)
+	}
+	assert.Equal(t, output.ARN, spanAttribute(root, attributeARN).AsString())
+	assert.Equal(t, outcomeTransformed, spanAttribute(root, attributeOutcome).AsString())
+	// the update only changes tags, which are extracted after the resource transformer
+	assert.Equal(t, outcomeNoOp, spanAttribute(spans["transformer.resource"], attributeOutcome).AsString())
+	assert.Equal(t, int64(len(addedTags)), spanAttribute(spans["transformer.tags"], attributeTagChanges).AsInt64())
+}
+
+func TestTransformSpansDeletedResource(t *testing.T) {
+	transformer, recorder := recordingTransformer()
+	_, err := transformer.Handle(context.Background(), deletedSubnetInput(t))
+	require.Nil(t, err)
+
+	// the ARN which AWS Config blanked is recovered by the resource transformer
+	spans := spansByName(recorder)
+	assert.Equal(t, deletedSubnetARN, spanAttribute(spans["transformer.handle"], attributeARN).AsString())
+	assert.Equal(t, deletedSubnetARN, spanAttribute(spans["transformer.resource"], attributeARN).AsString())
+	assert.Empty(t, spanAttribute(spans["transformer.parse"], attributeARN).AsString())
+}
+
+func TestTransformSpansMalformedMessage(t *testing.T) {
+	transformer, recorder := recordingTransformer()
+	_, err := transformer.Handle(context.Background(), Input{Message: "{"})
+	require.Error(t, err)
+
+	spans := spansByName(recorder)
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Error, spans["transformer.parse"].Status().Code)
+	assert.Equal(t, codes.Error, spans["transformer.handle"].Status().Code)
+	assert.Equal(t, outcomeError, spanAttribute(spans["transformer.handle"], attributeOutcome).AsString())
+}
+
+func TestTraceContext(t *testing.T) {
+	transformer, recorder := recordingTransformer()
+	input := readInput(t, "ec2.0.json")
+	handler := TraceContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := transformer.Handle(r.Context(), input)
+		require.Nil(t, err)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	root := spansByName(recorder)["transformer.handle"]
+	require.NotNil(t, root)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", root.Parent().SpanID().String())
+	assert.True(t, root.Parent().IsRemote())
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	provider, shutdown, err := NewTracerProvider(context.Background(), &TracingConfig{Exporter: TracingNone})
+	require.Nil(t, err)
+	assert.Nil(t, provider)
+	assert.Nil(t, shutdown(context.Background()))
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	provider, shutdown, err = NewTracerProvider(context.Background(), &TracingConfig{Exporter: TracingFile, Path: path, ServiceName: "test"})
+	require.Nil(t, err)
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "test.span")
+	span.End()
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	var exported struct {
+		Name        string
+		SpanContext struct {
+			TraceID string
+		}
+	}
+	require.Nil(t, json.Unmarshal(data, &exported))
+	assert.Equal(t, "test.span", exported.Name)
+	assert.Equal(t, span.SpanContext().TraceID().String(), exported.SpanContext.TraceID)
+
+	// spans which end after the shutdown are dropped rather than written to the closed file
+	require.Nil(t, shutdown(context.Background()))
+	_, span = provider.Tracer(tracerName).Start(context.Background(), "test.late")
+	span.End()
+	after, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, data, after)
+
+	_, _, err = NewTracerProvider(context.Background(), &TracingConfig{Exporter: "JAEGER"})
+	assert.Error(t, err)
+}
+
+func TestNewTracerProviderOTLP(t *testing.T) {
+	var paths []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	provider, shutdown, err := NewTracerProvider(context.Background(), &TracingConfig{
+		Exporter:    TracingOTLP,
+		Endpoint:    collector.URL + "/v1/traces",
+		ServiceName: "test",
+	})
+	require.Nil(t, err)
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "test.span")
+	span.End()
+
+	// the batch of spans is sent when the provider shuts down
+	assert.Empty(t, paths)
+	require.Nil(t, shutdown(context.Background()))
+	assert.Equal(t, []string{"/v1/traces"}, paths)
+
+	_, _, err = NewTracerProvider(context.Background(), &TracingConfig{Exporter: TracingOTLP, Endpoint: "localhost"})
+	assert.Error(t, err)
+}
@@ -3,11 +3,13 @@ package v1
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"net"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/service/configservice"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
 	"github.com/asecurityteam/awsconfig-transformerd/pkg/logs"
@@ -35,7 +37,7 @@ type Input struct {
 // Output is the result of the transformation
 type Output struct {
 	// ChangeTime is the time at which the asset change occurred, date-time format (required)
-	ChangeTime string `json:"changeTime"`
+	ChangeTime string `json:"changeTime" schema:"format=date-time"`
 
 	// ResourceType is the AWS resource type (required)
 	ResourceType string `json:"resourceType"`
@@ -49,11 +51,41 @@ type Output struct {
 	// ARN is the Amazon Resource Name (required)
 	ARN string `json:"arn"`
 
+	// ResourceID is the AWS identifier of the resource, e.g. an EC2 instance ID (required)
+	ResourceID string `json:"resourceId"`
+
+	// ResourceName is the custom name of the resource, if one exists
+	ResourceName string `json:"resourceName,omitempty"`
+
+	// AvailabilityZone is the availability zone of the resource, if applicable
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+
 	// Tags are key/value pairs set on the AWS resource (required)
 	Tags map[string]string `json:"tags"`
 
 	// Changes are a list of network related changes which occurred on the resource (required)
 	Changes []Change `json:"changes"`
+
+	// InstanceState is the state name of an EC2 instance after the change, e.g. "running" or "stopped"
+	InstanceState string `json:"instanceState,omitempty"`
+
+	// Scheme is the scheme of an ELB or ALB, "internet-facing" or "internal"
+	Scheme string `json:"scheme,omitempty"`
+
+	// Owner is the owner of the resource read from its tags, when tag normalisation is enabled
+	Owner *Owner `json:"owner,omitempty"`
+
+	// Disposition is the outcome of the transformation. Allowed values are "TRANSFORMED" when
+	// there are changes, "FILTERED" when the event was rejected, "UNSUPPORTED" when the resource
+	// type is ignored and "NO_OP" when nothing changed (required)
+	Disposition string `json:"disposition" schema:"enum=TRANSFORMED|FILTERED|UNSUPPORTED|NO_OP"`
+
+	// FilterReason explains why a filtered event was rejected
+	FilterReason string `json:"filterReason,omitempty"`
+
+	// Stale is set when the event is older than the last event processed for the resource,
+	// and stale events are marked rather than dropped
+	Stale bool `json:"stale,omitempty"`
 }
 
 // Change details network related changes for a resource
@@ -76,8 +108,38 @@ type Change struct {
 	// TagChanges changed keys/values per tag
 	TagChanges []TagChange `json:"tagChanges,omitempty"`
 
+	// NetworkInterfaces break the changed IP addresses of an EC2 instance down by network interface
+	NetworkInterfaces []NetworkInterface `json:"networkInterfaces,omitempty"`
+
+	// Listeners show the changed ports exposed by a classic ELB
+	Listeners []Listener `json:"listeners,omitempty"`
+
+	// Exposure classifies whether the changed addresses are reachable from the internet
+	Exposure *Exposure `json:"exposure,omitempty"`
+
 	// ChangeType indicates the type of change which occurred. Allowed values are "ADDED" or "DELETED"
-	ChangeType string `json:"changeType"`
+	ChangeType string `json:"changeType" schema:"enum=ADDED|DELETED"`
+}
+
+// NetworkInterface details the changed IP addresses which belong to one network interface
+type NetworkInterface = domain.NetworkInterface
+
+// Listener is a port exposed by a load balancer
+type Listener = domain.Listener
+
+// Owner identifies the owner of a resource from its normalised tags
+type Owner struct {
+	// Service is the name of the service the resource belongs to
+	Service string `json:"service,omitempty"`
+
+	// BusinessUnit is the business unit which owns the resource
+	BusinessUnit string `json:"businessUnit,omitempty"`
+
+	// Team is the team which operates the resource
+	Team string `json:"team,omitempty"`
+
+	// Contact is the person or address to contact about the resource
+	Contact string `json:"contact,omitempty"`
 }
 
 // TagChange represents a modification, addition or deletion of a resource tag key or value
@@ -92,61 +154,226 @@ type Tag struct {
 	Value string `json:"value"`
 }
 
+const (
+	// DispositionTransformed is the disposition of events which produced changes
+	DispositionTransformed = "TRANSFORMED"
+	// DispositionFiltered is the disposition of events which were rejected
+	DispositionFiltered = "FILTERED"
+	// DispositionUnsupported is the disposition of events of resource types which are ignored
+	DispositionUnsupported = "UNSUPPORTED"
+	// DispositionNoOp is the disposition of events which did not produce any changes
+	DispositionNoOp = "NO_OP"
+)
+
+const (
+	// ValidationOff disables output schema validation
+	ValidationOff = "OFF"
+	// ValidationFlag logs and counts outputs which do not conform to the schema, but still returns them
+	ValidationFlag = "FLAG"
+	// ValidationReject returns an error for outputs which do not conform to the schema
+	ValidationReject = "REJECT"
+)
+
+const (
+	// StaleDrop returns stale events without any changes
+	StaleDrop = "DROP"
+	// StaleMark returns stale events with the changes read from the AWS Config diff, marked as stale
+	StaleMark = "MARK"
+)
+
 // Transformer is a lambda handler which transforms incoming AWS Config change events
 type Transformer struct {
 	LogFn  domain.LogFn
 	StatFn domain.StatFn
+
+	// Validation is the output schema validation mode. The zero value disables validation.
+	Validation string
+
+	// State is an optional store of the last network identity emitted for each resource.
+	// When it is set, changes are computed against the last known state of the resource
+	// rather than read from the AWS Config diff, and stale events are detected.
+	State domain.StateStore
+
+	// StaleEvents is the handling of stale events when State is set. The zero value drops them.
+	StaleEvents string
+
+	// Assets is an optional store of the current snapshot of each resource, which is
+	// updated from every output and read by the AssetHandler
+	Assets domain.AssetStore
+
+	// Attributions is an optional store of the intervals during which each public IP
+	// address and hostname was held by a resource, which is updated from every output and
+	// read by the AttributionHandler
+	Attributions domain.AttributionStore
+
+	// CorporateRanges are publicly routable address ranges which are only reachable from the
+	// corporate network, so addresses within them are classified as private
+	CorporateRanges []*net.IPNet
+
+	// Tags optionally normalises the tags and tag changes of every output and extracts the
+	// owner of the resource from them
+	Tags *TagNormaliser
+
+	// TagChangeTypes are the resource types without network information for which tag changes
+	// are emitted, or AllResourceTypes. Resource types in TagChangeExcludedTypes are ignored.
+	TagChangeTypes         []string
+	TagChangeExcludedTypes []string
+
+	// Filter optionally filters events by resource type, account, region, tag and change type.
+	// Filtered events are rejected, so that only the description of the resource is returned.
+	Filter *EventFilter
+
+	// Tracer optionally records spans around the parsing of the event, the call to its
+	// ResourceTransformer and the extraction of its tag changes
+	Tracer trace.Tracer
+
+	// opened releases the tracer provider and stores opened by the TransformerComponent
+	opened []func(context.Context) error
+}
+
+// Shutdown flushes the spans of the transformer, and releases the tracer provider and stores
+// opened by the TransformerComponent. The transformer must not be used afterwards.
+func (t *Transformer) Shutdown(ctx context.Context) error {
+	err := release(ctx, t.opened)
+	t.opened = nil
+	return err
+}
+
+// release calls every release function, and returns the first error
+func release(ctx context.Context, opened []func(context.Context) error) error {
+	var first error
+	for _, fn := range opened {
+		if err := fn(ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
 }
 
 // Handle is an AWS Lambda handler which takes, as input, an SNS configuration change event notification.
 // The input is transformed into a JSON structure which highlights changes in the network details for this resource.
 // The output is the transformed JSON.
 func (t *Transformer) Handle(ctx context.Context, input Input) (Output, error) {
-
+	start := time.Now()
+	ctx, span := t.tracer().Start(ctx, "transformer.handle")
 	if ts, err := time.Parse(time.RFC3339Nano, input.ProcessedTimestamp); err == nil {
-		t.StatFn(ctx).Timing("event.awsconfig.transformer.event.delay", time.Since(ts))
+		t.stat(ctx).Timing("event.awsconfig.transformer.event.delay", time.Since(ts))
+	}
+
+	event, err := t.parse(ctx, input)
+	var output Output
+	if err == nil {
+		span.SetAttributes(eventAttributes(event)...)
+		output, err = t.transform(ctx, event)
 	}
+	t.recordMetrics(ctx, event, output, err, time.Since(start))
+	span.SetAttributes(outputAttributes(output, err)...)
+	endSpan(span, err)
+	return output, err
+}
 
+// parse reads the AWS Config event from the message of the input
+func (t *Transformer) parse(ctx context.Context, input Input) (awsConfigEvent, error) {
+	ctx, span := t.tracer().Start(ctx, "transformer.parse")
 	var event awsConfigEvent
 	err := json.Unmarshal([]byte(input.Message), &event)
 	if err != nil {
+		err = domain.ErrMalformedMessage{Reason: err.Error()}
 		t.LogFn(ctx).Error(logs.TransformError{Reason: err.Error()})
-		return Output{}, err
+		endSpan(span, err)
+		return awsConfigEvent{}, err
 	}
+	span.SetAttributes(eventAttributes(event)...)
+	// an empty message type is tolerated for events which were not delivered through SNS
+	if event.MessageType != "" && event.MessageType != configurationItemChangeNotification {
+		err = domain.ErrUnsupportedMessageType{MessageType: event.MessageType}
+		t.LogFn(ctx).Error(logs.TransformError{EventContext: eventContext(event, Output{}), Reason: err.Error()})
+		endSpan(span, err)
+		return awsConfigEvent{}, err
+	}
+	endSpan(span, nil)
+	return event, nil
+}
 
+// transform builds the output of a parsed event
+func (t *Transformer) transform(ctx context.Context, event awsConfigEvent) (Output, error) {
 	var output Output
 	var reject bool
+	var err error
+	var resourceTransformer ResourceTransformer
 
 	switch event.ConfigurationItem.ResourceType {
 	case configservice.ResourceTypeAwsEc2Instance:
-		output, reject, err = transformOutput(event, ec2Transformer{})
+		resourceTransformer = ec2Transformer{}
 	case configservice.ResourceTypeAwsElasticLoadBalancingLoadBalancer:
-		output, reject, err = transformOutput(event, elbTransformer{})
+		resourceTransformer = elbTransformer{}
 	case configservice.ResourceTypeAwsElasticLoadBalancingV2LoadBalancer:
 		// ALB Config events have the same as ELBs
-		output, reject, err = transformOutput(event, elbTransformer{})
+		resourceTransformer = elbTransformer{}
 	case configservice.ResourceTypeAwsEc2NetworkInterface:
-		output, reject, err = transformOutput(event, eniTransformer{})
+		resourceTransformer = eniTransformer{}
 	case configservice.ResourceTypeAwsEc2Subnet:
-		output, reject, err = transformOutput(event, subnetTransformer{})
+		resourceTransformer = subnetTransformer{}
 	default:
-		t.LogFn(ctx).Info(logs.UnsupportedResource{Resource: event.ConfigurationItem.ResourceType})
+		if t.emitsTagChanges(event.ConfigurationItem.ResourceType) {
+			resourceTransformer = tagChangeTransformer{}
+			break
+		}
+		t.LogFn(ctx).Info(logs.UnsupportedResource{
+			EventContext: eventContext(event, Output{}),
+			Resource:     event.ConfigurationItem.ResourceType,
+		})
+	}
+	supported := resourceTransformer != nil
+	_, tagChangesOnly := resourceTransformer.(tagChangeTransformer)
+	if supported {
+		output, reject, err = t.transformResource(ctx, event, resourceTransformer)
+		// AWS Config blanks the ARN of deleted resources, and it cannot be synthesised for
+		// every resource type which only emits tag changes, so those deletes are unsupported
+		var missing ErrMissingValue
+		if tagChangesOnly && errors.As(err, &missing) && missing.Field == "ARN" {
+			t.LogFn(ctx).Info(logs.UnsupportedResource{
+				EventContext: eventContext(event, Output{}),
+				Resource:     event.ConfigurationItem.ResourceType,
+			})
+			supported = false
+			err = nil
+		}
+		// tags are normalised before the filter, so that tag rules match canonical keys
+		// whichever alias the resource is tagged with
+		if err == nil && t.Tags != nil {
+			t.Tags.normalise(&output)
+		}
+		if err == nil && !reject && t.Filter != nil {
+			reject = t.applyFilter(ctx, event, &output)
+		}
+		// there is no network identity to compare for resources which only emit tag changes
+		if err == nil && !reject && t.State != nil && !tagChangesOnly {
+			output, reject, err = t.applyState(ctx, event, resourceTransformer, output)
+		}
 	}
 
 	if err != nil {
-		t.LogFn(ctx).Error(logs.TransformError{Reason: err.Error()})
+		t.logError(ctx, event, output, err)
 		// do not proceed to extract tags if the event is broken/malformed
 		return Output{}, err
 	}
 
-	tagChanges, err := extractTagChanges(event.ConfigurationItemDiff)
+	if !supported {
+		return Output{Disposition: DispositionUnsupported}, nil
+	}
+
+	tagChanges, err := t.extractTagChanges(ctx, event)
 	if err != nil {
-		t.LogFn(ctx).Error(logs.TransformError{Reason: err.Error()})
+		t.logError(ctx, event, output, err)
 		return Output{}, err
 	}
 	if !reject && len(tagChanges) > 0 {
+		if t.Tags != nil {
+			t.Tags.normaliseTagChanges(tagChanges)
+		}
 		op := added
-		if event.MessageType == delete {
+		if event.ConfigurationItemDiff.ChangeType == delete {
 			op = deleted
 		}
 		output.Changes = append(output.Changes, Change{
@@ -155,12 +382,127 @@ func (t *Transformer) Handle(ctx context.Context, input Input) (Output, error) {
 		})
 	}
 
-	return output, err
+	output.Disposition = disposition(reject, output)
+	t.classifyExposure(&output)
+	if err := t.validate(ctx, output); err != nil {
+		return Output{}, err
+	}
+	if t.Assets != nil && !reject && !output.Stale {
+		if err := t.recordAsset(ctx, event, output); err != nil {
+			t.logError(ctx, event, output, err)
+			return Output{}, err
+		}
+	}
+	if t.Attributions != nil && !reject && !output.Stale {
+		if err := t.recordAttributions(ctx, output); err != nil {
+			t.logError(ctx, event, output, err)
+			return Output{}, err
+		}
+	}
+
+	t.logDisposition(ctx, event, output)
+	return output, nil
+}
+
+// logError logs an error which stopped the transformation of an event, with the output
+// built so far
+func (t *Transformer) logError(ctx context.Context, event awsConfigEvent, output Output, err error) {
+	var malformed domain.ErrMalformedProperty
+	if errors.As(err, &malformed) {
+		t.LogFn(ctx).Error(logs.MalformedProperty{
+			EventContext: eventContext(event, output),
+			Field:        malformed.Field,
+			Reason:       err.Error(),
+		})
+		return
+	}
+	t.LogFn(ctx).Error(logs.TransformError{EventContext: eventContext(event, output), Reason: err.Error()})
+}
+
+// logDisposition logs the disposition of a supported event
+func (t *Transformer) logDisposition(ctx context.Context, event awsConfigEvent, output Output) {
+	if output.Disposition == DispositionFiltered {
+		t.LogFn(ctx).Info(logs.EventFiltered{EventContext: eventContext(event, output), Reason: output.FilterReason})
+		return
+	}
+	t.LogFn(ctx).Info(logs.EventTransformed{
+		EventContext: eventContext(event, output),
+		Disposition:  output.Disposition,
+		Changes:      len(output.Changes),
+		Stale:        output.Stale,
+	})
+}
+
+// eventContext identifies the event in log events. The ARN of the output is preferred, as
+// AWS Config blanks the ARN of the configuration item of a deleted resource.
+func eventContext(event awsConfigEvent, output Output) logs.EventContext {
+	arn := output.ARN
+	if arn == "" {
+		arn = event.ConfigurationItem.ARN
+	}
+	return logs.EventContext{
+		ARN:                  arn,
+		AccountID:            event.ConfigurationItem.AWSAccountID,
+		Region:               event.ConfigurationItem.AWSRegion,
+		ResourceType:         event.ConfigurationItem.ResourceType,
+		ChangeType:           event.ConfigurationItemDiff.ChangeType,
+		ConfigurationStateID: event.ConfigurationItem.ConfigurationStateID,
+	}
+}
+
+// disposition returns the disposition of a supported event
+func disposition(reject bool, output Output) string {
+	switch {
+	case reject:
+		return DispositionFiltered
+	case len(output.Changes) == 0:
+		return DispositionNoOp
+	}
+	return DispositionTransformed
 }
 
-func extractTagChanges(ev configurationItemDiff) ([]TagChange, error) {
+// validate checks the output against the published schema according to the validation mode
+func (t *Transformer) validate(ctx context.Context, output Output) error {
+	if t.Validation == "" || t.Validation == ValidationOff {
+		return nil
+	}
+	err := ValidateOutput(output)
+	if err == nil {
+		return nil
+	}
+	violation, ok := err.(ErrSchemaViolation)
+	if !ok {
+		violation = ErrSchemaViolation{Reason: err.Error()}
+	}
+	t.LogFn(ctx).Error(logs.SchemaViolation{Path: violation.Path, Reason: violation.Reason})
+	t.stat(ctx).Count("event.awsconfig.transformer.schema.violation", 1)
+	if t.Validation == ValidationReject {
+		return violation
+	}
+	return nil
+}
+
+// transformResource calls the resource transformer of the event within a span
+func (t *Transformer) transformResource(ctx context.Context, event awsConfigEvent, resourceTransformer ResourceTransformer) (Output, bool, error) {
+	_, span := t.tracer().Start(ctx, "transformer.resource", trace.WithAttributes(eventAttributes(event)...))
+	output, reject, err := transformOutput(event, resourceTransformer)
+	span.SetAttributes(outputAttributes(Output{ARN: output.ARN, Disposition: disposition(reject, output)}, err)...)
+	endSpan(span, err)
+	return output, reject, err
+}
+
+// extractTagChanges reads the tag changes of the event within a span
+func (t *Transformer) extractTagChanges(ctx context.Context, event awsConfigEvent) ([]TagChange, error) {
+	_, span := t.tracer().Start(ctx, "transformer.tags", trace.WithAttributes(eventAttributes(event)...))
+	tagChanges, err := extractTagChanges(event)
+	span.SetAttributes(attributeTagChanges.Int(len(tagChanges)))
+	endSpan(span, err)
+	return tagChanges, err
+}
+
+func extractTagChanges(event awsConfigEvent) ([]TagChange, error) {
 	res := make([]TagChange, 0)
-	for k, v := range ev.ChangedProperties {
+	for k, v := range event.ConfigurationItemDiff.ChangedProperties {
 		if !strings.HasPrefix(k, "Configuration.TagSet.") &&
 			!strings.HasPrefix(k, "SupplementaryConfiguration.TagSet.") &&
 			!strings.HasPrefix(k, "TagSet.") &&
@@ -168,11 +510,15 @@ func extractTagChanges(ev configurationItemDiff) ([]TagChange, error) {
 			continue
 		}
 		var tc TagChange
-		if err := json.Unmarshal(v, &tc); err != nil {
+		if err := unmarshalChangedProperty(event, k, v, &tc); err != nil {
 			return nil, err
 		}
 		if tc.PreviousValue == nil && tc.UpdatedValue == nil {
-			return nil, fmt.Errorf("malformed tag change event")
+			return nil, domain.ErrMalformedProperty{
+				Field:        "ChangedProperties." + k,
+				ResourceType: event.ConfigurationItem.ResourceType,
+				Err:          errors.New("tag change has neither a previous nor an updated value"),
+			}
 		}
 		res = append(res, tc)
 	}
@@ -206,6 +552,9 @@ func transformOutput(event awsConfigEvent, resourceTransformer ResourceTransform
 		if err != nil {
 			return Output{}, false, err
 		}
+		if err := recoverDeletedResource(event, &output); err != nil {
+			return Output{}, false, err
+		}
 		return output, reject, nil
 	}
 	return Output{}, false, nil
@@ -1,11 +1,14 @@
 package v1
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
@@ -50,6 +53,14 @@ func TestTransformInvalidJSON(t *testing.T) {
 	transformer := &Transformer{LogFn: logFn}
 	_, err := transformer.Handle(context.Background(), Input{Message: "not json"})
 	assert.NotNil(t, err, "expected non-nil")
+	assert.IsType(t, domain.ErrMalformedMessage{}, err)
+}
+
+func TestTransformUnsupportedMessageType(t *testing.T) {
+	transformer := &Transformer{LogFn: logFn}
+	message := `{"messageType": "ConfigurationSnapshotDeliveryCompleted", "configSnapshotId": "a1b2c3"}`
+	_, err := transformer.Handle(context.Background(), Input{Message: message})
+	assert.Equal(t, domain.ErrUnsupportedMessageType{MessageType: "ConfigurationSnapshotDeliveryCompleted"}, err)
 }
 
 func TestTransformEC2(t *testing.T) {
@@ -68,6 +79,7 @@ func TestTransformEC2(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Instance",
 				ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
 				Tags: map[string]string{
 					"business_unit": "CISO-Security",
 					"service_name":  "foo-bar",
@@ -77,7 +89,18 @@ func TestTransformEC2(t *testing.T) {
 						PrivateIPAddresses: []string{"172.31.30.79"},
 						PublicIPAddresses:  []string{"34.222.120.66"},
 						Hostnames:          []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
-						ChangeType:         "ADDED",
+						NetworkInterfaces: []NetworkInterface{
+							{
+								NetworkInterfaceID: "eni-05721fa8354d07b8c",
+								SubnetID:           "subnet-3d0b8c5a",
+								VpcID:              "vpc-b290fcd5",
+								PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+								PrivateIPAddresses: []string{"172.31.30.79"},
+								PublicIPAddresses:  []string{"34.222.120.66"},
+							},
+						},
+						Exposure:   &Exposure{Classification: ExposurePublic, Reasons: []string{"34.222.120.66 is a public IP address", "172.31.30.79 is in the RFC 1918 range 172.16.0.0/12"}},
+						ChangeType: "ADDED",
 					},
 				},
 			},
@@ -91,6 +114,7 @@ func TestTransformEC2(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Instance",
 				ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
 				Tags: map[string]string{
 					"business_unit": "CISO-Security",
 					"service_name":  "foo-bar",
@@ -100,7 +124,17 @@ func TestTransformEC2(t *testing.T) {
 						PrivateIPAddresses: []string{},
 						PublicIPAddresses:  []string{"34.222.120.66"},
 						Hostnames:          []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
-						ChangeType:         "DELETED",
+						NetworkInterfaces: []NetworkInterface{
+							{
+								NetworkInterfaceID: "eni-05721fa8354d07b8c",
+								SubnetID:           "subnet-3d0b8c5a",
+								VpcID:              "vpc-b290fcd5",
+								PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+								PublicIPAddresses:  []string{"34.222.120.66"},
+							},
+						},
+						Exposure:   &Exposure{Classification: ExposurePublic, Reasons: []string{"34.222.120.66 is a public IP address"}},
+						ChangeType: "DELETED",
 					},
 				},
 			},
@@ -114,6 +148,7 @@ func TestTransformEC2(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Instance",
 				ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
 				Tags: map[string]string{
 					"business_unit": "CISO-Security",
 					"service_name":  "foo-bar",
@@ -123,7 +158,17 @@ func TestTransformEC2(t *testing.T) {
 						PrivateIPAddresses: []string{},
 						PublicIPAddresses:  []string{"34.219.72.29"},
 						Hostnames:          []string{"ec2-34-219-72-29.us-west-2.compute.amazonaws.com"},
-						ChangeType:         "ADDED",
+						NetworkInterfaces: []NetworkInterface{
+							{
+								NetworkInterfaceID: "eni-05721fa8354d07b8c",
+								SubnetID:           "subnet-3d0b8c5a",
+								VpcID:              "vpc-b290fcd5",
+								PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+								PublicIPAddresses:  []string{"34.219.72.29"},
+							},
+						},
+						Exposure:   &Exposure{Classification: ExposurePublic, Reasons: []string{"34.219.72.29 is a public IP address"}},
+						ChangeType: "ADDED",
 					},
 				},
 			},
@@ -137,6 +182,7 @@ func TestTransformEC2(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Instance",
 				ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
 				Tags: map[string]string{
 					"business_unit": "CISO-Security",
 					"service_name":  "foo-bar",
@@ -146,7 +192,17 @@ func TestTransformEC2(t *testing.T) {
 						PrivateIPAddresses: []string{},
 						PublicIPAddresses:  []string{"34.219.72.29"},
 						Hostnames:          []string{"ec2-34-219-72-29.us-west-2.compute.amazonaws.com"},
-						ChangeType:         "DELETED",
+						NetworkInterfaces: []NetworkInterface{
+							{
+								NetworkInterfaceID: "eni-05721fa8354d07b8c",
+								SubnetID:           "subnet-3d0b8c5a",
+								VpcID:              "vpc-b290fcd5",
+								PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+								PublicIPAddresses:  []string{"34.219.72.29"},
+							},
+						},
+						Exposure:   &Exposure{Classification: ExposurePublic, Reasons: []string{"34.219.72.29 is a public IP address"}},
+						ChangeType: "DELETED",
 					},
 				},
 			},
@@ -160,6 +216,7 @@ func TestTransformEC2(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Instance",
 				ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
 				Tags: map[string]string{
 					"business_unit": "CISO-Security",
 					"service_name":  "foo-bar",
@@ -167,7 +224,17 @@ func TestTransformEC2(t *testing.T) {
 				Changes: []Change{
 					{
 						PrivateIPAddresses: []string{"172.31.30.79"},
-						ChangeType:         "DELETED",
+						NetworkInterfaces: []NetworkInterface{
+							{
+								NetworkInterfaceID: "eni-05721fa8354d07b8c",
+								SubnetID:           "subnet-3d0b8c5a",
+								VpcID:              "vpc-b290fcd5",
+								PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+								PrivateIPAddresses: []string{"172.31.30.79"},
+							},
+						},
+						Exposure:   &Exposure{Classification: ExposurePrivate, Reasons: []string{"172.31.30.79 is in the RFC 1918 range 172.16.0.0/12"}},
+						ChangeType: "DELETED",
 					},
 				},
 			},
@@ -181,12 +248,24 @@ func TestTransformEC2(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Instance",
 				ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
 				Changes: []Change{
 					{
 						PrivateIPAddresses: []string{"172.31.30.79"},
 						PublicIPAddresses:  []string{"34.222.120.66"},
 						Hostnames:          []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
-						ChangeType:         "ADDED",
+						NetworkInterfaces: []NetworkInterface{
+							{
+								NetworkInterfaceID: "eni-05721fa8354d07b8c",
+								SubnetID:           "subnet-3d0b8c5a",
+								VpcID:              "vpc-b290fcd5",
+								PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+								PrivateIPAddresses: []string{"172.31.30.79"},
+								PublicIPAddresses:  []string{"34.222.120.66"},
+							},
+						},
+						Exposure:   &Exposure{Classification: ExposurePublic, Reasons: []string{"34.222.120.66 is a public IP address", "172.31.30.79 is in the RFC 1918 range 172.16.0.0/12"}},
+						ChangeType: "ADDED",
 					},
 				},
 			},
@@ -200,10 +279,21 @@ func TestTransformEC2(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Instance",
 				ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+				ResourceID:   "i-0a763ac3ee37d8d2b",
 				Changes: []Change{
 					{
 						PrivateIPAddresses: []string{"172.31.30.79"},
-						ChangeType:         "DELETED",
+						NetworkInterfaces: []NetworkInterface{
+							{
+								NetworkInterfaceID: "eni-05721fa8354d07b8c",
+								SubnetID:           "subnet-3d0b8c5a",
+								VpcID:              "vpc-b290fcd5",
+								PrivateDNSName:     "ip-172-31-30-79.us-west-2.compute.internal",
+								PrivateIPAddresses: []string{"172.31.30.79"},
+							},
+						},
+						Exposure:   &Exposure{Classification: ExposurePrivate, Reasons: []string{"172.31.30.79 is in the RFC 1918 range 172.16.0.0/12"}},
+						ChangeType: "DELETED",
 					},
 				},
 			},
@@ -222,6 +312,7 @@ func TestTransformEC2(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Instance",
 				ARN:          "arn:aws:ec2:us-west-2:752631980301:instance/i-08f37101ae44e31e4",
+				ResourceID:   "i-08f37101ae44e31e4",
 				Tags: map[string]string{
 					"aws:autoscaling:groupName":     "status-page-web-graphql--stg-west2--314741c3cad246cebf35d178c10d086750--2019-12-11-00-56-utc--ohdjsjstilmha6fg--WebServer",
 					"aws:cloudformation:logical-id": "WebServer",
@@ -246,7 +337,25 @@ func TestTransformEC2(t *testing.T) {
 						PrivateIPAddresses: []string{"10.103.19.93", "10.107.70.212"},
 						PublicIPAddresses:  []string{"52.27.166.73"},
 						Hostnames:          []string{"ec2-52-27-166-73.us-west-2.compute.amazonaws.com"},
-						ChangeType:         "DELETED",
+						NetworkInterfaces: []NetworkInterface{
+							{
+								NetworkInterfaceID: "eni-0807480fbe7a96fb5",
+								SubnetID:           "subnet-b59edbd3",
+								VpcID:              "vpc-8cc869eb",
+								PrivateDNSName:     "ip-10-103-19-93.us-west-2.compute.internal",
+								PrivateIPAddresses: []string{"10.103.19.93"},
+								PublicIPAddresses:  []string{"52.27.166.73"},
+							},
+							{
+								NetworkInterfaceID: "eni-06a96d0149b3fd49e",
+								SubnetID:           "subnet-2f62a448",
+								VpcID:              "vpc-8cc869eb",
+								PrivateDNSName:     "ip-10-107-70-212.us-west-2.compute.internal",
+								PrivateIPAddresses: []string{"10.107.70.212"},
+							},
+						},
+						Exposure:   &Exposure{Classification: ExposurePublic, Reasons: []string{"52.27.166.73 is a public IP address", "10.103.19.93 is in the RFC 1918 range 10.0.0.0/8", "10.107.70.212 is in the RFC 1918 range 10.0.0.0/8"}},
+						ChangeType: "DELETED",
 					},
 				},
 			},
@@ -280,6 +389,7 @@ func TestTransformEC2(t *testing.T) {
 			assert.Equal(t, tt.ExpectedOutput.Region, output.Region)
 			assert.Equal(t, tt.ExpectedOutput.ResourceType, output.ResourceType)
 			assert.Equal(t, tt.ExpectedOutput.ARN, output.ARN)
+			assert.Equal(t, tt.ExpectedOutput.ResourceID, output.ResourceID)
 			assert.Equal(t, tt.ExpectedOutput.Tags, output.Tags)
 			assert.Equal(t, tt.ExpectedOutput.ChangeTime, output.ChangeTime)
 			assert.ElementsMatch(t, tt.ExpectedOutput.Changes, output.Changes)
@@ -287,6 +397,96 @@ func TestTransformEC2(t *testing.T) {
 	}
 }
 
+func TestTransformEC2StateTransitions(t *testing.T) {
+	tc := []struct {
+		Name          string
+		InputFile     string
+		InstanceState string
+		Expected      []Change
+	}{
+		{
+			Name:          "stopped",
+			InputFile:     "ec2.1.json",
+			InstanceState: "stopped",
+			Expected: []Change{{
+				PrivateIPAddresses: []string{},
+				PublicIPAddresses:  []string{"34.222.120.66"},
+				Hostnames:          []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
+				Exposure:           &Exposure{Classification: ExposurePublic, Reasons: []string{"34.222.120.66 is a public IP address"}},
+				ChangeType:         deleted,
+			}},
+		},
+		{
+			Name:          "started",
+			InputFile:     "ec2.2.json",
+			InstanceState: "running",
+			Expected: []Change{{
+				PrivateIPAddresses: []string{},
+				PublicIPAddresses:  []string{"34.219.72.29"},
+				Hostnames:          []string{"ec2-34-219-72-29.us-west-2.compute.amazonaws.com"},
+				Exposure:           &Exposure{Classification: ExposurePublic, Reasons: []string{"34.219.72.29 is a public IP address"}},
+				ChangeType:         added,
+			}},
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext}
+			input := readInput(t, tt.InputFile)
+
+			// the interfaces are not always diffed when the public IP address changes
+			var message map[string]interface{}
+			require.Nil(t, json.Unmarshal([]byte(input.Message), &message))
+			diff := message["configurationItemDiff"].(map[string]interface{})
+			changedProperties := diff["changedProperties"].(map[string]interface{})
+			for key := range changedProperties {
+				if strings.HasPrefix(key, "Configuration.NetworkInterfaces.") {
+					changedProperties = withoutKey(changedProperties, key)
+				}
+			}
+			diff["changedProperties"] = changedProperties
+			raw, err := json.Marshal(message)
+			require.Nil(t, err)
+			input.Message = string(raw)
+
+			output, err := transformer.Handle(context.Background(), input)
+			require.Nil(t, err)
+			assert.Equal(t, tt.InstanceState, output.InstanceState)
+			assert.ElementsMatch(t, tt.Expected, output.Changes)
+		})
+	}
+}
+
+func TestTransformEC2InstanceState(t *testing.T) {
+	transformer := &Transformer{LogFn: logFn, StatFn: runhttp.StatFromContext}
+	withConfiguration := func(name string, configuration interface{}) Input {
+		input := readInput(t, name)
+		var message map[string]interface{}
+		require.Nil(t, json.Unmarshal([]byte(input.Message), &message))
+		message["configurationItem"].(map[string]interface{})["configuration"] = configuration
+		raw, err := json.Marshal(message)
+		require.Nil(t, err)
+		input.Message = string(raw)
+		return input
+	}
+
+	// AWS Config blanks the configuration of a deleted instance
+	output, err := transformer.Handle(context.Background(), readInput(t, "ec2.4.json"))
+	require.Nil(t, err)
+	assert.Equal(t, "terminated", output.InstanceState)
+
+	output, err = transformer.Handle(context.Background(), withConfiguration("ec2.4.json",
+		map[string]interface{}{"state": map[string]interface{}{"code": 48, "name": "shutting-down"}}))
+	require.Nil(t, err)
+	assert.Equal(t, "shutting-down", output.InstanceState)
+
+	_, err = transformer.Handle(context.Background(), withConfiguration("ec2.2.json", "running"))
+	var malformed domain.ErrMalformedProperty
+	require.True(t, errors.As(err, &malformed))
+	assert.Equal(t, "Configuration", malformed.Field)
+}
+
 func TestTransformSubnet(t *testing.T) {
 	tc := []struct {
 		Name           string
@@ -309,6 +509,7 @@ func TestTransformSubnet(t *testing.T) {
 				},
 				Changes: []Change{
 					{
+						Exposure:         &Exposure{Classification: ExposurePrivate, Reasons: []string{"10.0.0.0/24 is in the RFC 1918 range 10.0.0.0/8"}},
 						ChangeType:       added,
 						CIDRBlock:        "10.0.0.0/24",
 						RelatedResources: []string{"vpc-000aa0a000a00a0aa"},
@@ -341,9 +542,12 @@ func TestTransformSubnet(t *testing.T) {
 				Region:       "us-west-2",
 				ResourceType: "AWS::EC2::Subnet",
 				ARN:          "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-000aa0a000a00a0aa",
-				Tags:         map[string]string{},
+				Tags: map[string]string{
+					"key1": "1",
+				},
 				Changes: []Change{
 					{
+						Exposure:         &Exposure{Classification: ExposurePrivate, Reasons: []string{"10.0.0.0/24 is in the RFC 1918 range 10.0.0.0/8"}},
 						ChangeType:       deleted,
 						CIDRBlock:        "10.0.0.0/24",
 						RelatedResources: []string{"vpc-000aa0a000a00a0aa"},
@@ -384,6 +588,28 @@ func TestTransformSubnet(t *testing.T) {
 	}
 }
 
+func TestTransformDeleteRecoversResourceID(t *testing.T) {
+	event := awsConfigEvent{
+		ConfigurationItem: configurationItem{
+			AWSAccountID:                 "123456789012",
+			AWSRegion:                    "us-west-2",
+			ConfigurationItemCaptureTime: "2022-09-01T01:05:14.878Z",
+			ResourceType:                 "AWS::EC2::Subnet",
+			ARN:                          "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-000aa0a000a00a0aa",
+		},
+		ConfigurationItemDiff: configurationItemDiff{
+			ChangeType: delete,
+			ChangedProperties: map[string]json.RawMessage{
+				"Configuration": json.RawMessage(`{"previousValue": {"cidrBlock": "10.0.0.0/24", "vpcId": "vpc-000aa0a000a00a0aa"}, "updatedValue": null, "changeType": "DELETE"}`),
+				"ResourceId":    json.RawMessage(`{"previousValue": "subnet-000aa0a000a00a0aa", "updatedValue": null, "changeType": "DELETE"}`),
+			},
+		},
+	}
+	output, _, err := transformOutput(event, subnetTransformer{})
+	require.Nil(t, err)
+	assert.Equal(t, "subnet-000aa0a000a00a0aa", output.ResourceID)
+}
+
 func Test_extractTagChanges(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -448,7 +674,7 @@ func Test_extractTagChanges(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := extractTagChanges(tt.ev)
+			got, err := extractTagChanges(awsConfigEvent{ConfigurationItemDiff: tt.ev})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("extractTagChanges() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -459,3 +685,113 @@ func Test_extractTagChanges(t *testing.T) {
 		})
 	}
 }
+
+func TestDisposition(t *testing.T) {
+	assert.Equal(t, DispositionFiltered, disposition(true, Output{}))
+	assert.Equal(t, DispositionNoOp, disposition(false, Output{}))
+	assert.Equal(t, DispositionTransformed, disposition(false, Output{Changes: []Change{{ChangeType: added}}}))
+}
+
+func TestRetainChangedInterfaces(t *testing.T) {
+	change := Change{
+		PrivateIPAddresses: []string{"10.0.1.5"},
+		PublicIPAddresses:  []string{"34.222.120.66"},
+		NetworkInterfaces: []NetworkInterface{
+			{NetworkInterfaceID: "eni-1", SubnetID: "subnet-1", PrivateIPAddresses: []string{"10.0.0.5"}, PublicIPAddresses: []string{"34.222.120.66"}},
+			{NetworkInterfaceID: "eni-2", SubnetID: "subnet-2", PrivateIPAddresses: []string{"10.0.1.5", "10.0.1.6"}},
+			{NetworkInterfaceID: "eni-3", SubnetID: "subnet-3", PrivateIPAddresses: []string{"10.0.2.5"}},
+		},
+	}
+	retainChangedInterfaces(&change)
+	assert.Equal(t, []NetworkInterface{
+		{NetworkInterfaceID: "eni-1", SubnetID: "subnet-1", PublicIPAddresses: []string{"34.222.120.66"}},
+		{NetworkInterfaceID: "eni-2", SubnetID: "subnet-2", PrivateIPAddresses: []string{"10.0.1.5"}},
+	}, change.NetworkInterfaces)
+
+	change = Change{NetworkInterfaces: change.NetworkInterfaces}
+	retainChangedInterfaces(&change)
+	assert.Nil(t, change.NetworkInterfaces)
+}
+
+// decodeLogs returns the log events written to the buffer
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var events []map[string]interface{}
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var event map[string]interface{}
+		require.Nil(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestTransformLogsEventContext(t *testing.T) {
+	var buf bytes.Buffer
+	transformer := &Transformer{
+		LogFn:  func(context.Context) domain.Logger { return logevent.New(logevent.Config{Output: &buf}) },
+		StatFn: runhttp.StatFromContext,
+	}
+
+	output, err := transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	events := decodeLogs(t, &buf)
+	require.Len(t, events, 1)
+	assert.Equal(t, "event-transformed", events[0]["message"])
+	assert.Equal(t, output.ARN, events[0]["arn"])
+	assert.Equal(t, output.AccountID, events[0]["account_id"])
+	assert.Equal(t, output.Region, events[0]["region"])
+	assert.Equal(t, "AWS::EC2::Instance", events[0]["resource_type"])
+	assert.Equal(t, "CREATE", events[0]["change_type"])
+	assert.NotZero(t, events[0]["configuration_state_id"])
+	assert.Equal(t, DispositionTransformed, events[0]["disposition"])
+	assert.Equal(t, float64(len(output.Changes)), events[0]["changes"])
+
+	_, err = transformer.Handle(context.Background(), readInput(t, "elbv2.update.malformed-tags.json"))
+	require.Error(t, err)
+	events = decodeLogs(t, &buf)
+	require.Len(t, events, 1)
+	assert.Equal(t, "malformed-property", events[0]["message"])
+	assert.Contains(t, events[0]["field"], "TagSet")
+	assert.Equal(t, "AWS::ElasticLoadBalancingV2::LoadBalancer", events[0]["resource_type"])
+	assert.Equal(t, "UPDATE", events[0]["change_type"])
+
+	transformer.Filter = &EventFilter{ExcludeChangeTypes: []string{"CREATE"}}
+	_, err = transformer.Handle(context.Background(), readInput(t, "ec2.0.json"))
+	require.Nil(t, err)
+	events = decodeLogs(t, &buf)
+	require.Len(t, events, 1)
+	assert.Equal(t, "event-filtered", events[0]["message"])
+	assert.Equal(t, "change type CREATE is excluded", events[0]["reason"])
+	assert.Equal(t, output.ARN, events[0]["arn"])
+
+	// AWS Config blanks the ARN of a deleted resource, so the recovered ARN is logged
+	transformer.Filter = nil
+	_, err = transformer.Handle(context.Background(), deletedSubnetInput(t))
+	require.Nil(t, err)
+	events = decodeLogs(t, &buf)
+	require.Len(t, events, 1)
+	assert.Equal(t, deletedSubnetARN, events[0]["arn"])
+}
+
+const deletedSubnetARN = "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-000aa0a000a00a0aa"
+
+// deletedSubnetInput is the delete of a subnet whose ARN was blanked by AWS Config
+func deletedSubnetInput(t *testing.T) Input {
+	raw, err := json.Marshal(awsConfigEvent{
+		ConfigurationItem: configurationItem{
+			AWSAccountID:                 "123456789012",
+			AWSRegion:                    "us-west-2",
+			ConfigurationItemCaptureTime: "2022-09-01T01:05:14.878Z",
+			ResourceType:                 "AWS::EC2::Subnet",
+		},
+		ConfigurationItemDiff: configurationItemDiff{
+			ChangeType: delete,
+			ChangedProperties: map[string]json.RawMessage{
+				"Configuration": json.RawMessage(`{"previousValue": {"cidrBlock": "10.0.0.0/24", "vpcId": "vpc-000aa0a000a00a0aa"}, "updatedValue": null, "changeType": "DELETE"}`),
+				"ResourceId":    json.RawMessage(`{"previousValue": "subnet-000aa0a000a00a0aa", "updatedValue": null, "changeType": "DELETE"}`),
+			},
+		},
+	})
+	require.Nil(t, err)
+	return Input{Message: string(raw)}
+}
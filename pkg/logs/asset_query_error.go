@@ -0,0 +1,7 @@
+package logs
+
+// AssetQueryError is logged when an asset snapshot query cannot be answered
+type AssetQueryError struct {
+	Message string `logevent:"message,default=asset-query-error"`
+	Reason  string `logevent:"reason"`
+}
@@ -0,0 +1,7 @@
+package logs
+
+// AttributionQueryError is logged when an attribution query cannot be answered
+type AttributionQueryError struct {
+	Message string `logevent:"message,default=attribution-query-error"`
+	Reason  string `logevent:"reason"`
+}
@@ -0,0 +1,12 @@
+package logs
+
+// EventContext identifies the AWS Config event which a log event is about. It is embedded in
+// the log events of the transformer so that the events of a single resource can be traced.
+type EventContext struct {
+	ARN                  string `logevent:"arn"`
+	AccountID            string `logevent:"account_id"`
+	Region               string `logevent:"region"`
+	ResourceType         string `logevent:"resource_type"`
+	ChangeType           string `logevent:"change_type"`
+	ConfigurationStateID int64  `logevent:"configuration_state_id"`
+}
@@ -0,0 +1,8 @@
+package logs
+
+// EventFiltered is logged when the changes of an event are rejected
+type EventFiltered struct {
+	Message string `logevent:"message,default=event-filtered"`
+	EventContext
+	Reason string `logevent:"reason"`
+}
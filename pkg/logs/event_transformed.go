@@ -0,0 +1,11 @@
+package logs
+
+// EventTransformed is logged when an event is transformed, whether or not it produced any changes
+type EventTransformed struct {
+	Message string `logevent:"message,default=event-transformed"`
+	EventContext
+	// Disposition is either TRANSFORMED or NO_OP
+	Disposition string `logevent:"disposition"`
+	Changes     int    `logevent:"changes"`
+	Stale       bool   `logevent:"stale"`
+}
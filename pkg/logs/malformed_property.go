@@ -0,0 +1,9 @@
+package logs
+
+// MalformedProperty is logged when a configuration or a changed property of an event does not have the expected shape
+type MalformedProperty struct {
+	Message string `logevent:"message,default=malformed-property"`
+	EventContext
+	Field  string `logevent:"field"`
+	Reason string `logevent:"reason"`
+}
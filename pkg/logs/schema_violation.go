@@ -0,0 +1,8 @@
+package logs
+
+// SchemaViolation is logged when a transformed output does not conform to the published JSON Schema
+type SchemaViolation struct {
+	Message string `logevent:"message,default=schema-violation"`
+	Path    string `logevent:"path"`
+	Reason  string `logevent:"reason"`
+}
@@ -0,0 +1,12 @@
+package logs
+
+// StaleEvent is logged when an event is older than the last event processed for the same resource
+type StaleEvent struct {
+	Message string `logevent:"message,default=stale-event"`
+	EventContext
+	LastConfigurationStateID int64  `logevent:"last_configuration_state_id"`
+	CaptureTime              string `logevent:"capture_time"`
+	LastCaptureTime          string `logevent:"last_capture_time"`
+	// Action is either dropped or marked, according to the stale event mode
+	Action string `logevent:"action"`
+}
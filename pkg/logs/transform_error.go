@@ -1,7 +1,9 @@
 package logs
 
-// TransformError is logged when the transformer is unable to transform the config event
+// TransformError is logged when the transformer is unable to transform the config event. The
+// event context is empty when the message could not be parsed.
 type TransformError struct {
 	Message string `logevent:"message,default=transform-error"`
-	Reason  string `logevent:"reason"`
+	EventContext
+	Reason string `logevent:"reason"`
 }
@@ -2,6 +2,7 @@ package logs
 
 // UnsupportedResource is logged when the transformer receives an unsupported AWS resource
 type UnsupportedResource struct {
-	Message  string `logevent:"message,default=unsupported-resource"`
+	Message string `logevent:"message,default=unsupported-resource"`
+	EventContext
 	Resource string `logevent:"resource"`
 }
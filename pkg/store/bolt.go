@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+)
+
+// resourceStateBucket holds the JSON encoded resource states, keyed by ARN
+var resourceStateBucket = []byte("resource-state")
+
+// Bolt is a StateStore which persists resource states in an embedded bbolt database file
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens, or creates, the database file at the given path. Only one process may
+// have the file open at a time.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := openBolt(path, resourceStateBucket)
+	if err != nil {
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// openBolt opens the database file and creates the bucket if it does not exist
+func openBolt(path string, bucket []byte) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Get returns the state of the resource with the given ARN
+func (b *Bolt) Get(_ context.Context, arn string) (domain.ResourceState, bool, error) {
+	var state domain.ResourceState
+	var found bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(resourceStateBucket).Get([]byte(arn))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(raw, &state)
+	})
+	return state, found, err
+}
+
+// Put replaces the state of the resource
+func (b *Bolt) Put(_ context.Context, state domain.ResourceState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(resourceStateBucket).Put([]byte(state.ARN), raw)
+	})
+}
+
+// Update replaces the state of the resource with the one returned by the function, in a
+// single transaction
+func (b *Bolt) Update(_ context.Context, arn string, fn func(domain.ResourceState, bool) (domain.ResourceState, error)) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(resourceStateBucket)
+		var state domain.ResourceState
+		raw := bucket.Get([]byte(arn))
+		if raw != nil {
+			if err := json.Unmarshal(raw, &state); err != nil {
+				return err
+			}
+		}
+		state, err := fn(state, raw != nil)
+		if err != nil {
+			return err
+		}
+		raw, err = json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(arn), raw)
+	})
+}
+
+// Close releases the database file
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// assetBucket holds the JSON encoded assets, keyed by ARN
+var assetBucket = []byte("asset")
+
+// BoltAssets is an AssetStore which persists assets in an embedded bbolt database file
+type BoltAssets struct {
+	db *bolt.DB
+}
+
+// OpenBoltAssets opens, or creates, the database file at the given path. Only one process
+// may have the file open at a time.
+func OpenBoltAssets(path string) (*BoltAssets, error) {
+	db, err := openBolt(path, assetBucket)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltAssets{db: db}, nil
+}
+
+// Get returns the asset with the given ARN
+func (b *BoltAssets) Get(_ context.Context, arn string) (domain.Asset, bool, error) {
+	var asset domain.Asset
+	var found bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(assetBucket).Get([]byte(arn))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(raw, &asset)
+	})
+	return asset, found, err
+}
+
+// Put replaces the asset
+func (b *BoltAssets) Put(_ context.Context, asset domain.Asset) error {
+	raw, err := json.Marshal(asset)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(assetBucket).Put([]byte(asset.ARN), raw)
+	})
+}
+
+// Update replaces the asset with the one returned by the function, in a single transaction
+func (b *BoltAssets) Update(_ context.Context, arn string, fn func(domain.Asset, bool) (domain.Asset, error)) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(assetBucket)
+		var asset domain.Asset
+		raw := bucket.Get([]byte(arn))
+		if raw != nil {
+			if err := json.Unmarshal(raw, &asset); err != nil {
+				return err
+			}
+		}
+		asset, err := fn(asset, raw != nil)
+		if err != nil {
+			return err
+		}
+		raw, err = json.Marshal(asset)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(arn), raw)
+	})
+}
+
+// Delete removes the asset with the given ARN
+func (b *BoltAssets) Delete(_ context.Context, arn string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(assetBucket).Delete([]byte(arn))
+	})
+}
+
+// Find returns the assets matching the query, ordered by ARN. Every asset is read, as
+// only the ARN is indexed.
+func (b *BoltAssets) Find(_ context.Context, query domain.AssetQuery) ([]domain.Asset, error) {
+	var result []domain.Asset
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(assetBucket)
+		if query.ARN != "" {
+			raw := bucket.Get([]byte(query.ARN))
+			if raw == nil {
+				return nil
+			}
+			var asset domain.Asset
+			if err := json.Unmarshal(raw, &asset); err != nil {
+				return err
+			}
+			result = append(result, asset)
+			return nil
+		}
+		return bucket.ForEach(func(_, raw []byte) error {
+			var asset domain.Asset
+			if err := json.Unmarshal(raw, &asset); err != nil {
+				return err
+			}
+			if matches(asset, query) {
+				result = append(result, asset)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Close releases the database file
+func (b *BoltAssets) Close() error {
+	return b.db.Close()
+}
+
+// attributionBucket holds the JSON encoded intervals of each address, keyed by address
+var attributionBucket = []byte("attribution")
+
+// BoltAttributions is an AttributionStore which persists intervals in an embedded bbolt
+// database file
+type BoltAttributions struct {
+	db *bolt.DB
+}
+
+// OpenBoltAttributions opens, or creates, the database file at the given path. Only one
+// process may have the file open at a time.
+func OpenBoltAttributions(path string) (*BoltAttributions, error) {
+	db, err := openBolt(path, attributionBucket)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltAttributions{db: db}, nil
+}
+
+// Get returns the intervals of the address
+func (b *BoltAttributions) Get(_ context.Context, address string) ([]domain.Attribution, error) {
+	var attributions []domain.Attribution
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(attributionBucket).Get([]byte(address))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &attributions)
+	})
+	return attributions, err
+}
+
+// Update replaces the intervals of the address with those returned by the function, in
+// a single transaction
+func (b *BoltAttributions) Update(_ context.Context, address string, fn func([]domain.Attribution) ([]domain.Attribution, error)) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(attributionBucket)
+		var attributions []domain.Attribution
+		if raw := bucket.Get([]byte(address)); raw != nil {
+			if err := json.Unmarshal(raw, &attributions); err != nil {
+				return err
+			}
+		}
+		attributions, err := fn(attributions)
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(attributions)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(address), raw)
+	})
+}
+
+// Close releases the database file
+func (b *BoltAttributions) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,3 @@
+// Package store contains implementations of the state, asset and attribution stores defined in the
+// domain package.
+package store
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"net"
+	"strings"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+)
+
+// matches reports whether the asset is selected by the query
+func matches(asset domain.Asset, query domain.AssetQuery) bool {
+	switch {
+	case query.ARN != "":
+		return asset.ARN == query.ARN
+	case query.IP != nil:
+		return anyIP(asset, func(ip net.IP) bool { return ip.Equal(query.IP) })
+	case query.Hostname != "":
+		for _, hostname := range asset.Hostnames {
+			if strings.EqualFold(hostname, query.Hostname) {
+				return true
+			}
+		}
+		return false
+	case query.CIDR != nil:
+		if anyIP(asset, query.CIDR.Contains) {
+			return true
+		}
+		for _, cidrBlock := range asset.CIDRBlocks {
+			_, block, err := net.ParseCIDR(cidrBlock)
+			if err == nil && (block.Contains(query.CIDR.IP) || query.CIDR.Contains(block.IP)) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func anyIP(asset domain.Asset, match func(net.IP) bool) bool {
+	for _, ips := range [][]string{asset.PrivateIPAddresses, asset.PublicIPAddresses} {
+		for _, address := range ips {
+			if ip := net.ParseIP(address); ip != nil && match(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+)
+
+// DefaultTombstoneTTL is how long the Memory state store keeps the state of a deleted resource by default
+const DefaultTombstoneTTL = 24 * time.Hour
+
+// Memory is a StateStore which holds resource states in memory. States are lost when
+// the process exits.
+//
+// The state of a deleted resource is kept as a tombstone so that events delivered after
+// the deletion are recognised as stale. Tombstones are evicted once they are older than
+// the TombstoneTTL, so the store does not grow with every resource ever deleted; an event
+// delivered later than that is no longer recognised as stale, and is handled as the first
+// event seen for the resource.
+type Memory struct {
+	// TombstoneTTL is how long the state of a deleted resource is kept. Zero keeps it forever.
+	TombstoneTTL time.Duration
+	// Now returns the current time. The zero value uses time.Now.
+	Now func() time.Time
+
+	mu     sync.RWMutex
+	states map[string]domain.ResourceState
+	// deletedAt holds the time at which each tombstone was written
+	deletedAt map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemory returns an empty in-memory state store which evicts tombstones after the DefaultTombstoneTTL
+func NewMemory() *Memory {
+	return &Memory{
+		TombstoneTTL: DefaultTombstoneTTL,
+		states:       map[string]domain.ResourceState{},
+		deletedAt:    map[string]time.Time{},
+	}
+}
+
+// Get returns the state of the resource with the given ARN
+func (m *Memory) Get(_ context.Context, arn string) (domain.ResourceState, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, ok := m.lookup(arn, m.now())
+	return state, ok, nil
+}
+
+// Put replaces the state of the resource
+func (m *Memory) Put(_ context.Context, state domain.ResourceState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store(state.ARN, state, m.now())
+	return nil
+}
+
+// Update replaces the state of the resource with the one returned by the function
+func (m *Memory) Update(_ context.Context, arn string, fn func(domain.ResourceState, bool) (domain.ResourceState, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	state, ok := m.lookup(arn, now)
+	state, err := fn(state, ok)
+	if err != nil {
+		return err
+	}
+	m.store(arn, state, now)
+	return nil
+}
+
+// lookup returns the state of the resource, unless it is an expired tombstone. The caller holds the lock.
+func (m *Memory) lookup(arn string, now time.Time) (domain.ResourceState, bool) {
+	if m.expired(arn, now) {
+		return domain.ResourceState{}, false
+	}
+	state, ok := m.states[arn]
+	return state, ok
+}
+
+// store replaces the state of the resource and evicts the expired tombstones at most once
+// per TombstoneTTL. The caller holds the write lock.
+func (m *Memory) store(arn string, state domain.ResourceState, now time.Time) {
+	_, tombstone := m.deletedAt[arn]
+	tombstone = tombstone && !m.expired(arn, now)
+	m.states[arn] = state
+	if state.Deleted {
+		// the TTL runs from the deletion rather than from the last write of the tombstone
+		if !tombstone {
+			m.deletedAt[arn] = now
+		}
+	} else {
+		delete(m.deletedAt, arn)
+	}
+	if m.TombstoneTTL <= 0 || now.Sub(m.lastSweep) < m.TombstoneTTL {
+		return
+	}
+	m.lastSweep = now
+	for tombstone := range m.deletedAt {
+		if m.expired(tombstone, now) {
+			delete(m.states, tombstone)
+			delete(m.deletedAt, tombstone)
+		}
+	}
+}
+
+// expired reports whether the resource is a tombstone older than the TombstoneTTL
+func (m *Memory) expired(arn string, now time.Time) bool {
+	deletedAt, ok := m.deletedAt[arn]
+	return ok && m.TombstoneTTL > 0 && now.Sub(deletedAt) >= m.TombstoneTTL
+}
+
+func (m *Memory) now() time.Time {
+	if m.Now == nil {
+		return time.Now()
+	}
+	return m.Now()
+}
+
+// MemoryAssets is an AssetStore which holds assets in memory. Assets are lost when the
+// process exits.
+type MemoryAssets struct {
+	mu     sync.RWMutex
+	assets map[string]domain.Asset
+}
+
+// NewMemoryAssets returns an empty in-memory asset store
+func NewMemoryAssets() *MemoryAssets {
+	return &MemoryAssets{assets: map[string]domain.Asset{}}
+}
+
+// Get returns the asset with the given ARN
+func (m *MemoryAssets) Get(_ context.Context, arn string) (domain.Asset, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	asset, ok := m.assets[arn]
+	return asset, ok, nil
+}
+
+// Put replaces the asset
+func (m *MemoryAssets) Put(_ context.Context, asset domain.Asset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.assets[asset.ARN] = asset
+	return nil
+}
+
+// Update replaces the asset with the one returned by the function
+func (m *MemoryAssets) Update(_ context.Context, arn string, fn func(domain.Asset, bool) (domain.Asset, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	asset, ok := m.assets[arn]
+	asset, err := fn(asset, ok)
+	if err != nil {
+		return err
+	}
+	m.assets[arn] = asset
+	return nil
+}
+
+// Delete removes the asset with the given ARN
+func (m *MemoryAssets) Delete(_ context.Context, arn string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.assets, arn)
+	return nil
+}
+
+// Find returns the assets matching the query, ordered by ARN
+func (m *MemoryAssets) Find(_ context.Context, query domain.AssetQuery) ([]domain.Asset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []domain.Asset
+	for _, asset := range m.assets {
+		if matches(asset, query) {
+			result = append(result, asset)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ARN < result[j].ARN })
+	return result, nil
+}
+
+// MemoryAttributions is an AttributionStore which holds intervals in memory. Intervals
+// are lost when the process exits.
+type MemoryAttributions struct {
+	mu           sync.RWMutex
+	attributions map[string][]domain.Attribution
+}
+
+// NewMemoryAttributions returns an empty in-memory attribution store
+func NewMemoryAttributions() *MemoryAttributions {
+	return &MemoryAttributions{attributions: map[string][]domain.Attribution{}}
+}
+
+// Get returns the intervals of the address
+func (m *MemoryAttributions) Get(_ context.Context, address string) ([]domain.Attribution, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]domain.Attribution(nil), m.attributions[address]...), nil
+}
+
+// Update replaces the intervals of the address with those returned by the function
+func (m *MemoryAttributions) Update(_ context.Context, address string, fn func([]domain.Attribution) ([]domain.Attribution, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attributions, err := fn(append([]domain.Attribution(nil), m.attributions[address]...))
+	if err != nil {
+		return err
+	}
+	m.attributions[address] = attributions
+	return nil
+}
@@ -0,0 +1,329 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/awsconfig-transformerd/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStateStore checks the behaviour shared by every StateStore implementation
+func testStateStore(t *testing.T, s domain.StateStore) {
+	ctx := context.Background()
+	arn := "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b"
+
+	_, found, err := s.Get(ctx, arn)
+	require.Nil(t, err)
+	assert.False(t, found)
+
+	state := domain.ResourceState{
+		ARN:                  arn,
+		ResourceType:         "AWS::EC2::Instance",
+		ConfigurationStateID: 1550868190208,
+		PrivateIPAddresses:   []string{"172.31.30.79"},
+		PublicIPAddresses:    []string{"34.222.120.66"},
+		Hostnames:            []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
+	}
+	require.Nil(t, s.Put(ctx, state))
+	stored, found, err := s.Get(ctx, arn)
+	require.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, state, stored)
+
+	deleted := domain.ResourceState{ARN: arn, ResourceType: "AWS::EC2::Instance", ConfigurationStateID: 1550871117042, Deleted: true}
+	require.Nil(t, s.Put(ctx, deleted))
+	stored, found, err = s.Get(ctx, arn)
+	require.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, deleted, stored)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, s.Put(ctx, domain.ResourceState{ARN: arn, ConfigurationStateID: int64(i)}))
+			_, _, err := s.Get(ctx, arn)
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// concurrent updates are applied one after the other
+	require.Nil(t, s.Put(ctx, domain.ResourceState{ARN: arn}))
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, s.Update(ctx, arn, func(state domain.ResourceState, found bool) (domain.ResourceState, error) {
+				assert.True(t, found)
+				state.ConfigurationStateID++
+				return state, nil
+			}))
+		}()
+	}
+	wg.Wait()
+	stored, _, err = s.Get(ctx, arn)
+	require.Nil(t, err)
+	assert.Equal(t, int64(10), stored.ConfigurationStateID)
+
+	// a failed update leaves the state unchanged
+	failure := errors.New("failed")
+	assert.Equal(t, failure, s.Update(ctx, arn, func(domain.ResourceState, bool) (domain.ResourceState, error) {
+		return domain.ResourceState{}, failure
+	}))
+	stored, _, err = s.Get(ctx, arn)
+	require.Nil(t, err)
+	assert.Equal(t, int64(10), stored.ConfigurationStateID)
+}
+
+func TestMemory(t *testing.T) {
+	testStateStore(t, NewMemory())
+}
+
+func TestMemoryTombstones(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2019, 2, 22, 20, 0, 0, 0, time.UTC)
+	s := NewMemory()
+	s.TombstoneTTL = time.Hour
+	s.Now = func() time.Time { return now }
+
+	deleted := domain.ResourceState{ARN: "arn:aws:ec2:us-west-2:123456789012:instance/i-1", Deleted: true}
+	live := domain.ResourceState{ARN: "arn:aws:ec2:us-west-2:123456789012:instance/i-2"}
+	require.Nil(t, s.Put(ctx, deleted))
+	require.Nil(t, s.Put(ctx, live))
+
+	// the tombstone is kept until it is older than the TTL
+	now = now.Add(59 * time.Minute)
+	_, found, err := s.Get(ctx, deleted.ARN)
+	require.Nil(t, err)
+	assert.True(t, found)
+
+	now = now.Add(time.Minute)
+	_, found, err = s.Get(ctx, deleted.ARN)
+	require.Nil(t, err)
+	assert.False(t, found)
+	require.Nil(t, s.Update(ctx, deleted.ARN, func(state domain.ResourceState, found bool) (domain.ResourceState, error) {
+		assert.False(t, found)
+		return domain.ResourceState{ARN: deleted.ARN, Deleted: true}, nil
+	}))
+	_, found, err = s.Get(ctx, deleted.ARN)
+	require.Nil(t, err)
+	assert.True(t, found)
+	// the expired tombstones are evicted on the next write, and the states of live resources are kept
+	require.Nil(t, s.Put(ctx, domain.ResourceState{ARN: "arn:aws:ec2:us-west-2:123456789012:instance/i-3", Deleted: true}))
+	now = now.Add(2 * time.Hour)
+	require.Nil(t, s.Put(ctx, live))
+	assert.Len(t, s.states, 1)
+	assert.Empty(t, s.deletedAt)
+
+	// a resource which is recreated is no longer a tombstone
+	require.Nil(t, s.Put(ctx, deleted))
+	deleted.Deleted = false
+	require.Nil(t, s.Put(ctx, deleted))
+	now = now.Add(2 * time.Hour)
+	_, found, err = s.Get(ctx, deleted.ARN)
+	require.Nil(t, err)
+	assert.True(t, found)
+
+	// tombstones are kept forever without a TTL
+	s.TombstoneTTL = 0
+	deleted.Deleted = true
+	require.Nil(t, s.Put(ctx, deleted))
+	now = now.Add(24 * 365 * time.Hour)
+	_, found, err = s.Get(ctx, deleted.ARN)
+	require.Nil(t, err)
+	assert.True(t, found)
+}
+
+func TestBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := OpenBolt(path)
+	require.Nil(t, err)
+	testStateStore(t, s)
+
+	// states survive reopening the file
+	require.Nil(t, s.Put(context.Background(), domain.ResourceState{ARN: "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-1", CIDRBlocks: []string{"10.0.0.0/24"}}))
+	require.Nil(t, s.Close())
+	s, err = OpenBolt(path)
+	require.Nil(t, err)
+	defer s.Close()
+	stored, found, err := s.Get(context.Background(), "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-1")
+	require.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []string{"10.0.0.0/24"}, stored.CIDRBlocks)
+}
+
+// testAssetStore checks the behaviour shared by every AssetStore implementation
+func testAssetStore(t *testing.T, s domain.AssetStore) {
+	ctx := context.Background()
+	instance := domain.Asset{
+		ARN:                "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+		ResourceType:       "AWS::EC2::Instance",
+		ResourceID:         "i-0a763ac3ee37d8d2b",
+		AccountID:          "123456789012",
+		Region:             "us-west-2",
+		Tags:               map[string]string{"service_name": "foo"},
+		PrivateIPAddresses: []string{"172.31.30.79"},
+		PublicIPAddresses:  []string{"34.222.120.66"},
+		Hostnames:          []string{"ec2-34-222-120-66.us-west-2.compute.amazonaws.com"},
+		FirstSeen:          time.Date(2019, 2, 22, 20, 43, 10, 0, time.UTC),
+		LastSeen:           time.Date(2019, 2, 22, 21, 2, 18, 0, time.UTC),
+	}
+	subnet := domain.Asset{
+		ARN:          "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-0b2f2b9c1a7e4b1d5",
+		ResourceType: "AWS::EC2::Subnet",
+		ResourceID:   "subnet-0b2f2b9c1a7e4b1d5",
+		AccountID:    "123456789012",
+		Region:       "us-west-2",
+		CIDRBlocks:   []string{"172.31.16.0/20", "2600:1f14::/64"},
+	}
+
+	_, found, err := s.Get(ctx, instance.ARN)
+	require.Nil(t, err)
+	assert.False(t, found)
+	require.Nil(t, s.Put(ctx, instance))
+	require.Nil(t, s.Put(ctx, subnet))
+	stored, found, err := s.Get(ctx, instance.ARN)
+	require.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, instance, stored)
+
+	mustCIDR := func(cidr string) *net.IPNet {
+		_, block, err := net.ParseCIDR(cidr)
+		require.Nil(t, err)
+		return block
+	}
+	tc := []struct {
+		Name     string
+		Query    domain.AssetQuery
+		Expected []domain.Asset
+	}{
+		{Name: "arn", Query: domain.AssetQuery{ARN: subnet.ARN}, Expected: []domain.Asset{subnet}},
+		{Name: "unknown-arn", Query: domain.AssetQuery{ARN: "arn:aws:ec2:us-west-2:123456789012:instance/i-1"}},
+		{Name: "public-ip", Query: domain.AssetQuery{IP: net.ParseIP("34.222.120.66")}, Expected: []domain.Asset{instance}},
+		{Name: "private-ip", Query: domain.AssetQuery{IP: net.ParseIP("172.31.30.79")}, Expected: []domain.Asset{instance}},
+		{Name: "unknown-ip", Query: domain.AssetQuery{IP: net.ParseIP("34.222.120.67")}},
+		{Name: "hostname", Query: domain.AssetQuery{Hostname: "EC2-34-222-120-66.us-west-2.compute.amazonaws.com"}, Expected: []domain.Asset{instance}},
+		{Name: "cidr-contains-ip-and-block", Query: domain.AssetQuery{CIDR: mustCIDR("172.31.0.0/16")}, Expected: []domain.Asset{instance, subnet}},
+		{Name: "cidr-within-block", Query: domain.AssetQuery{CIDR: mustCIDR("172.31.17.0/24")}, Expected: []domain.Asset{subnet}},
+		{Name: "cidr-ipv6", Query: domain.AssetQuery{CIDR: mustCIDR("2600:1f14::/56")}, Expected: []domain.Asset{subnet}},
+		{Name: "cidr-disjoint", Query: domain.AssetQuery{CIDR: mustCIDR("10.0.0.0/8")}},
+	}
+	for _, tt := range tc {
+		found, err := s.Find(ctx, tt.Query)
+		require.Nil(t, err, tt.Name)
+		assert.Equal(t, tt.Expected, found, tt.Name)
+	}
+
+	// concurrent updates are applied one after the other
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, s.Update(ctx, instance.ARN, func(asset domain.Asset, found bool) (domain.Asset, error) {
+				assert.True(t, found)
+				asset.Hostnames = append(asset.Hostnames, fmt.Sprintf("host-%d.example.com", i))
+				return asset, nil
+			}))
+		}(i)
+	}
+	wg.Wait()
+	stored, _, err = s.Get(ctx, instance.ARN)
+	require.Nil(t, err)
+	assert.Len(t, stored.Hostnames, 11)
+
+	require.Nil(t, s.Delete(ctx, instance.ARN))
+	require.Nil(t, s.Delete(ctx, instance.ARN))
+	_, found, err = s.Get(ctx, instance.ARN)
+	require.Nil(t, err)
+	assert.False(t, found)
+	require.Nil(t, s.Update(ctx, instance.ARN, func(asset domain.Asset, found bool) (domain.Asset, error) {
+		assert.False(t, found)
+		asset.ARN = instance.ARN
+		return asset, nil
+	}))
+	stored, found, err = s.Get(ctx, instance.ARN)
+	require.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, domain.Asset{ARN: instance.ARN}, stored)
+}
+
+func TestMemoryAssets(t *testing.T) {
+	testAssetStore(t, NewMemoryAssets())
+}
+
+func TestBoltAssets(t *testing.T) {
+	s, err := OpenBoltAssets(filepath.Join(t.TempDir(), "assets.db"))
+	require.Nil(t, err)
+	defer s.Close()
+	testAssetStore(t, s)
+}
+
+// testAttributionStore checks the behaviour shared by every AttributionStore implementation
+func testAttributionStore(t *testing.T, s domain.AttributionStore) {
+	ctx := context.Background()
+	address := "34.222.120.66"
+	attributions, err := s.Get(ctx, address)
+	require.Nil(t, err)
+	assert.Empty(t, attributions)
+
+	claim := domain.Attribution{
+		Address:      address,
+		ARN:          "arn:aws:ec2:us-west-2:123456789012:instance/i-0a763ac3ee37d8d2b",
+		ResourceType: "AWS::EC2::Instance",
+		AccountID:    "123456789012",
+		Region:       "us-west-2",
+		Start:        time.Date(2019, 2, 22, 20, 43, 10, 0, time.UTC),
+	}
+	require.Nil(t, s.Update(ctx, address, func(current []domain.Attribution) ([]domain.Attribution, error) {
+		assert.Empty(t, current)
+		return append(current, claim), nil
+	}))
+	attributions, err = s.Get(ctx, address)
+	require.Nil(t, err)
+	assert.Equal(t, []domain.Attribution{claim}, attributions)
+
+	// a failed update leaves the intervals unchanged
+	failure := errors.New("failed")
+	assert.Equal(t, failure, s.Update(ctx, address, func([]domain.Attribution) ([]domain.Attribution, error) {
+		return nil, failure
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, s.Update(ctx, address, func(current []domain.Attribution) ([]domain.Attribution, error) {
+				next := claim
+				next.Start = claim.Start.Add(time.Duration(i+1) * time.Hour)
+				return append(current, next), nil
+			}))
+		}(i)
+	}
+	wg.Wait()
+	attributions, err = s.Get(ctx, address)
+	require.Nil(t, err)
+	assert.Len(t, attributions, 11)
+}
+
+func TestMemoryAttributions(t *testing.T) {
+	testAttributionStore(t, NewMemoryAttributions())
+}
+
+func TestBoltAttributions(t *testing.T) {
+	s, err := OpenBoltAttributions(filepath.Join(t.TempDir(), "attribution.db"))
+	require.Nil(t, err)
+	defer s.Close()
+	testAttributionStore(t, s)
+}